@@ -0,0 +1,82 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// Rejection is returned by a C2BValidationFunc to reject a payment with a
+// specific C2B result code.
+type Rejection struct {
+	Code        string
+	Description string
+}
+
+// Error implements the error interface.
+func (r *Rejection) Error() string {
+	return "payment rejected: " + r.Code + " " + r.Description
+}
+
+// Reject returns a Rejection for one of the types.C2B* result codes.
+func Reject(code string) error {
+	return &Rejection{Code: code, Description: types.C2BResultDescription(code)}
+}
+
+// C2BValidationFunc decides whether to accept a C2B payment. Returning nil
+// accepts it, returning a *Rejection rejects it with that code, and any other
+// error rejects it with types.C2BOtherError.
+type C2BValidationFunc func(ctx context.Context, tx *types.C2BTransaction) error
+
+// C2BConfirmationFunc handles a completed C2B payment.
+type C2BConfirmationFunc func(ctx context.Context, tx *types.C2BTransaction) error
+
+// C2BValidationHandler returns an http.Handler for the ValidationURL. It always
+// answers with a types.C2BValidationResponse so Daraja receives a decision;
+// payloads that cannot be decoded are rejected.
+func C2BValidationHandler(fn C2BValidationFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		var tx types.C2BTransaction
+		err := json.Unmarshal(body, &tx)
+		if err == nil {
+			err = fn(r.Context(), &tx)
+		}
+		writeJSON(w, http.StatusOK, validationResponse(err))
+	})
+}
+
+// validationResponse converts the outcome of a validation into a response.
+func validationResponse(err error) types.C2BValidationResponse {
+	if err == nil {
+		return types.C2BValidationResponse{ResultCode: types.C2BAccepted, ResultDesc: types.C2BResultDescription(types.C2BAccepted)}
+	}
+	var rejection *Rejection
+	if !errors.As(err, &rejection) {
+		rejection = &Rejection{Code: types.C2BOtherError, Description: types.C2BResultDescription(types.C2BOtherError)}
+	}
+	return types.C2BValidationResponse{ResultCode: rejection.Code, ResultDesc: "Rejected"}
+}
+
+// C2BConfirmationHandler returns an http.Handler for the ConfirmationURL. It
+// decodes the payment, passes it to fn and acknowledges it.
+func C2BConfirmationHandler(fn C2BConfirmationFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		var tx types.C2BTransaction
+		if err := json.Unmarshal(body, &tx); err != nil || tx.TransID == "" {
+			http.Error(w, "invalid C2B confirmation", http.StatusBadRequest)
+			return
+		}
+		acknowledge(w, fn(r.Context(), &tx))
+	})
+}
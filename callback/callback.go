@@ -0,0 +1,54 @@
+// Package callback provides HTTP handlers for the requests Daraja sends to the
+// callback, confirmation, validation and result URLs registered by the client.
+package callback
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxBodySize limits the size of callback bodies read from Daraja.
+const maxBodySize = 1 << 20
+
+// Acknowledgement is the response body Daraja expects from a callback URL.
+type Acknowledgement struct {
+	ResultCode int    `json:"ResultCode"`
+	ResultDesc string `json:"ResultDesc"`
+}
+
+// Accepted is the acknowledgement sent when a callback was processed.
+var Accepted = Acknowledgement{ResultCode: 0, ResultDesc: "Accepted"}
+
+// readBody reads a POSTed callback body, writing an error response and
+// returning false if the request cannot be processed.
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to read body: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// writeJSON writes v as a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// acknowledge replies to Daraja according to the outcome of the user handler.
+func acknowledge(w http.ResponseWriter, err error) {
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Acknowledgement{ResultCode: 1, ResultDesc: "Rejected"})
+		return
+	}
+	writeJSON(w, http.StatusOK, Accepted)
+}
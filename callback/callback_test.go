@@ -0,0 +1,399 @@
+// Package callback_test contains unit tests for the Daraja callback handlers.
+package callback_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/callback"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// post sends body to handler and returns the recorded response.
+func post(handler http.Handler, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/callback", strings.NewReader(body)))
+	return rec
+}
+
+// decodeAck decodes a callback acknowledgement from rec.
+func decodeAck(t *testing.T, rec *httptest.ResponseRecorder) callback.Acknowledgement {
+	var ack callback.Acknowledgement
+	if err := json.NewDecoder(rec.Body).Decode(&ack); err != nil {
+		t.Fatalf("failed to decode acknowledgement: %v", err)
+	}
+	return ack
+}
+
+const stkSuccess = `{
+	"Body": {
+		"stkCallback": {
+			"MerchantRequestID": "29115-34620561-1",
+			"CheckoutRequestID": "ws_CO_191220191020363925",
+			"ResultCode": 0,
+			"ResultDesc": "The service request is processed successfully.",
+			"CallbackMetadata": {
+				"Item": [
+					{"Name": "Amount", "Value": 1.00},
+					{"Name": "MpesaReceiptNumber", "Value": "NLJ7RT61SV"},
+					{"Name": "Balance"},
+					{"Name": "TransactionDate", "Value": 20191219102115},
+					{"Name": "PhoneNumber", "Value": 254708374149}
+				]
+			}
+		}
+	}
+}`
+
+// TestSTKPushHandler_Success tests decoding of a successful STK callback.
+func TestSTKPushHandler_Success(t *testing.T) {
+	var got *types.STKCallback
+	handler := callback.STKPushHandler(func(ctx context.Context, cb *types.STKCallback) error {
+		got = cb
+		return nil
+	})
+
+	rec := post(handler, stkSuccess)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ack := decodeAck(t, rec); ack.ResultCode != 0 {
+		t.Errorf("expected ResultCode 0, got %d", ack.ResultCode)
+	}
+	if !got.Success() {
+		t.Errorf("expected success, got result code %s", got.ResultCode)
+	}
+	if got.Amount != 1*types.Shilling || got.MpesaReceiptNumber != "NLJ7RT61SV" || got.PhoneNumber != "254708374149" {
+		t.Errorf("unexpected callback %+v", got)
+	}
+	want := time.Date(2019, 12, 19, 10, 21, 15, 0, utils.Nairobi)
+	if !got.TransactionDate.Equal(want) {
+		t.Errorf("expected transaction date %v, got %v", want, got.TransactionDate)
+	}
+}
+
+// TestSTKPushHandler_Cancelled tests decoding of a cancelled STK callback without metadata.
+func TestSTKPushHandler_Cancelled(t *testing.T) {
+	var got *types.STKCallback
+	handler := callback.STKPushHandler(func(ctx context.Context, cb *types.STKCallback) error {
+		got = cb
+		return nil
+	})
+
+	body := `{"Body":{"stkCallback":{"MerchantRequestID":"8555-67195-1","CheckoutRequestID":"ws_CO_27072017151044001","ResultCode":1032,"ResultDesc":"[STK_CB - ]Request cancelled by user"}}}`
+	if rec := post(handler, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got.Success() || got.ResultCode != types.ResultCodeCancelledByUser {
+		t.Errorf("expected cancelled callback, got %+v", got)
+	}
+}
+
+// TestSTKPushHandler_Errors tests malformed bodies and handler failures.
+func TestSTKPushHandler_Errors(t *testing.T) {
+	handler := callback.STKPushHandler(func(ctx context.Context, cb *types.STKCallback) error {
+		return errors.New("database down")
+	})
+	if rec := post(handler, `{"Body":{}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", rec.Code)
+	}
+	if rec := post(handler, stkSuccess); rec.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rec.Code)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/callback", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, got %d", rec.Code)
+	}
+}
+
+const c2bPayment = `{
+	"TransactionType": "Pay Bill",
+	"TransID": "RKTQDM7W6S",
+	"TransTime": "20191122063845",
+	"TransAmount": "10",
+	"BusinessShortCode": "600638",
+	"BillRefNumber": "invoice008",
+	"InvoiceNumber": "",
+	"OrgAccountBalance": "49197.00",
+	"ThirdPartyTransID": "",
+	"MSISDN": "25470****149",
+	"FirstName": "John",
+	"MiddleName": "",
+	"LastName": "Doe"
+}`
+
+// TestC2BValidationHandler tests accepting and rejecting C2B payments.
+func TestC2BValidationHandler(t *testing.T) {
+	handler := callback.C2BValidationHandler(func(ctx context.Context, tx *types.C2BTransaction) error {
+		switch tx.BillRefNumber {
+		case "invoice008":
+			return nil
+		case "unknown":
+			return callback.Reject(types.C2BInvalidAccountNumber)
+		}
+		return errors.New("lookup failed")
+	})
+
+	tests := map[string]string{
+		c2bPayment: types.C2BAccepted,
+		strings.Replace(c2bPayment, "invoice008", "unknown", 1): types.C2BInvalidAccountNumber,
+		strings.Replace(c2bPayment, "invoice008", "other", 1):   types.C2BOtherError,
+		`not json`: types.C2BOtherError,
+	}
+	for body, code := range tests {
+		rec := post(handler, body)
+		var resp types.C2BValidationResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if rec.Code != http.StatusOK || resp.ResultCode != code {
+			t.Errorf("expected status 200 and code %s, got %d and %s", code, rec.Code, resp.ResultCode)
+		}
+	}
+}
+
+// TestC2BConfirmationHandler tests decoding of a C2B confirmation.
+func TestC2BConfirmationHandler(t *testing.T) {
+	var got *types.C2BTransaction
+	handler := callback.C2BConfirmationHandler(func(ctx context.Context, tx *types.C2BTransaction) error {
+		got = tx
+		return nil
+	})
+
+	rec := post(handler, c2bPayment)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ack := decodeAck(t, rec); ack.ResultCode != 0 {
+		t.Errorf("expected ResultCode 0, got %d", ack.ResultCode)
+	}
+	if got.TransID != "RKTQDM7W6S" || got.MSISDN != "25470****149" {
+		t.Errorf("unexpected transaction %+v", got)
+	}
+	if got.TransAmount != 10*types.Shilling || got.OrgAccountBalance != 49197*types.Shilling {
+		t.Errorf("expected amount 10 and balance 49197, got %v and %v", got.TransAmount, got.OrgAccountBalance)
+	}
+	if _, err := got.Time(); err != nil {
+		t.Errorf("expected valid TransTime, got %v", err)
+	}
+}
+
+const b2cResult = `{
+	"Result": {
+		"ResultType": 0,
+		"ResultCode": 0,
+		"ResultDesc": "The service request is processed successfully.",
+		"OriginatorConversationID": "10571-7910404-1",
+		"ConversationID": "AG_20191219_00004e48cf7e3533f581",
+		"TransactionID": "NLJ41HAY6Q",
+		"ResultParameters": {
+			"ResultParameter": [
+				{"Key": "TransactionAmount", "Value": 10},
+				{"Key": "TransactionReceipt", "Value": "NLJ41HAY6Q"},
+				{"Key": "B2CRecipientIsRegisteredCustomer", "Value": "Y"},
+				{"Key": "B2CChargesPaidAccountAvailableFunds", "Value": -4510.00},
+				{"Key": "ReceiverPartyPublicName", "Value": "254708374149 - John Doe"},
+				{"Key": "TransactionCompletedDateTime", "Value": "19.12.2019 11:45:50"},
+				{"Key": "B2CUtilityAccountAvailableFunds", "Value": 10116.00},
+				{"Key": "B2CWorkingAccountAvailableFunds", "Value": 900000.00}
+			]
+		},
+		"ReferenceData": {
+			"ReferenceItem": {"Key": "QueueTimeoutURL", "Value": "https://internalsandbox.safaricom.co.ke/mpesa/b2cresults/v1/submit"}
+		}
+	}
+}`
+
+// TestB2CResultHandler tests decoding of a B2C result.
+func TestB2CResultHandler(t *testing.T) {
+	var got *types.B2CResult
+	handler := callback.B2CResultHandler(func(ctx context.Context, result *types.B2CResult) error {
+		got = result
+		return nil
+	})
+
+	if rec := post(handler, b2cResult); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if !got.Success() || got.ConversationID != "AG_20191219_00004e48cf7e3533f581" {
+		t.Errorf("unexpected result %+v", got.Result)
+	}
+	if got.TransactionAmount != 10*types.Shilling || got.TransactionReceipt != "NLJ41HAY6Q" || !got.B2CRecipientIsRegisteredCustomer {
+		t.Errorf("unexpected B2C result %+v", got)
+	}
+	if got.B2CUtilityAccountAvailableFunds != 10116*types.Shilling || got.ReceiverPartyPublicName != "254708374149 - John Doe" {
+		t.Errorf("unexpected B2C result %+v", got)
+	}
+	if want := time.Date(2019, 12, 19, 11, 45, 50, 0, utils.Nairobi); !got.TransactionCompletedDateTime.Equal(want) {
+		t.Errorf("expected completion time %v, got %v", want, got.TransactionCompletedDateTime)
+	}
+	if len(got.ReferenceData) != 1 || got.ReferenceData[0].Key != "QueueTimeoutURL" {
+		t.Errorf("unexpected reference data %+v", got.ReferenceData)
+	}
+}
+
+// TestB2CResultHandler_UnreadableParameter tests that a result with an unreadable parameter is still delivered.
+func TestB2CResultHandler_UnreadableParameter(t *testing.T) {
+	var got *types.B2CResult
+	handler := callback.B2CResultHandler(func(ctx context.Context, result *types.B2CResult) error {
+		got = result
+		return nil
+	})
+
+	body := strings.Replace(b2cResult, "19.12.2019 11:45:50", "2019-12-19T11:45:50", 1)
+	if rec := post(handler, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got == nil || got.ParseError == nil {
+		t.Fatalf("expected the result with a parse error, got %+v", got)
+	}
+	if got.TransactionReceipt != "NLJ41HAY6Q" || got.B2CWorkingAccountAvailableFunds != 900000*types.Shilling {
+		t.Errorf("expected the readable parameters, got %+v", got)
+	}
+}
+
+// TestB2BExpressCheckoutHandler tests decoding of successful and cancelled B2B Express Checkout callbacks.
+func TestB2BExpressCheckoutHandler(t *testing.T) {
+	var got *types.B2BExpressCheckoutCallback
+	handler := callback.B2BExpressCheckoutHandler(func(ctx context.Context, cb *types.B2BExpressCheckoutCallback) error {
+		got = cb
+		return nil
+	})
+
+	success := `{"resultCode":"0","resultDesc":"The service request is processed successfully.","amount":"71.0",` +
+		`"requestId":"404e1aec-19e0-4ce3-973d-bd92e94c8021","resultType":"0","conversationID":"AG_20230426_2010434680d9f5a73766",` +
+		`"transactionId":"RDQ01NFT1Q","status":"SUCCESS"}`
+	if rec := post(handler, success); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if !got.Success() || got.Amount != 71*types.Shilling || got.TransactionID != "RDQ01NFT1Q" || got.ConversationID != "AG_20230426_2010434680d9f5a73766" {
+		t.Errorf("unexpected callback %+v", got)
+	}
+
+	cancelled := `{"resultCode":4001,"resultDesc":"User cancelled transaction","requestId":"c2a9ba32-9e11-4b90-892c-7bc54944609a",` +
+		`"amount":"71.0","paymentReference":"MAndbubry3hi"}`
+	if rec := post(handler, cancelled); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got.Success() || got.ResultCode != "4001" || got.PaymentReference != "MAndbubry3hi" {
+		t.Errorf("unexpected callback %+v", got)
+	}
+
+	if rec := post(handler, `{"status":"SUCCESS"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 without resultCode, got %d", rec.Code)
+	}
+}
+
+// TestTransactionStatusResultHandler tests decoding of a failed status result and a timeout.
+const b2bResult = `{
+	"Result": {
+		"ResultType": 0,
+		"ResultCode": 0,
+		"ResultDesc": "The service request is processed successfully.",
+		"OriginatorConversationID": "34619-6424302-1",
+		"ConversationID": "AG_20230420_2010759fd5662ef6d054",
+		"TransactionID": "RDQ01NFT1Q",
+		"ResultParameters": {
+			"ResultParameter": [
+				{"Key": "DebitAccountBalance", "Value": "Working Account|KES|46713.00|46713.00|0.00|0.00"},
+				{"Key": "Amount", "Value": 10.00},
+				{"Key": "DebitPartyAffectedAccountBalance", "Value": "Working Account|KES|46713.00|46713.00|0.00|0.00"},
+				{"Key": "TransCompletedTime", "Value": 20230420101405},
+				{"Key": "DebitPartyCharges", "Value": "Business Pay Bill Charge|KES|77.00"},
+				{"Key": "ReceiverPartyPublicName", "Value": "000000 - Biller Company"},
+				{"Key": "Currency", "Value": "KES"},
+				{"Key": "InitiatorAccountCurrentBalance", "Value": "{Amount={BasicAmount=46713.00, MinimumAmount=4671300, CurrencyCode=KES}}"}
+			]
+		}
+	}
+}`
+
+// TestB2BResultHandler tests decoding of the balances and charges of a B2B result.
+func TestB2BResultHandler(t *testing.T) {
+	var got *types.B2BResult
+	handler := callback.B2BResultHandler(func(ctx context.Context, result *types.B2BResult) error {
+		got = result
+		return nil
+	})
+
+	if rec := post(handler, b2bResult); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got.ParseError != nil || got.Amount != 10*types.Shilling || got.DebitPartyCharges != 77*types.Shilling {
+		t.Errorf("unexpected B2B result %+v", got)
+	}
+	balance := 46713 * types.Shilling
+	if got.DebitAccountBalance != balance || got.DebitPartyAffectedAccountBalance != balance || got.InitiatorAccountCurrentBalance != balance {
+		t.Errorf("expected balances of %v, got %+v", balance, got)
+	}
+}
+
+func TestTransactionStatusResultHandler(t *testing.T) {
+	var got *types.TransactionStatusResult
+	handler := callback.TransactionStatusResultHandler(func(ctx context.Context, result *types.TransactionStatusResult) error {
+		got = result
+		return nil
+	})
+
+	body := `{"Result":{"ResultType":0,"ResultCode":"2001","ResultDesc":"The initiator information is invalid.","OriginatorConversationID":"1236-7134259-1","ConversationID":"AG_20210709_1234409f86436c583e3f","TransactionID":"SEI0000000"}}`
+	if rec := post(handler, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if got.Success() || got.ResultCode != types.ResultCodeInvalidInitiator || got.ReceiptNo != "" {
+		t.Errorf("unexpected status result %+v", got)
+	}
+
+	var timeout *types.Result
+	timeoutHandler := callback.TimeoutHandler(func(ctx context.Context, result *types.Result) error {
+		timeout = result
+		return nil
+	})
+	body = `{"Result":{"ResultType":1,"ResultCode":"SFC_IC0003","ResultDesc":"Timeout","OriginatorConversationID":"1236-7134259-1","ConversationID":"AG_20210709_1234409f86436c583e3f"}}`
+	if rec := post(timeoutHandler, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if timeout.ResultCode != "SFC_IC0003" {
+		t.Errorf("expected result code %s, got %s", "SFC_IC0003", timeout.ResultCode)
+	}
+}
+
+// TestBalanceResultHandler tests decoding of an account balance result.
+func TestBalanceResultHandler(t *testing.T) {
+	var got *types.BalanceResult
+	handler := callback.BalanceResultHandler(func(ctx context.Context, result *types.BalanceResult) error {
+		got = result
+		return nil
+	})
+
+	body := `{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.","OriginatorConversationID":"16917-22577599-3","ConversationID":"AG_20200206_00005e091a8ec6b9eac5","TransactionID":"OA90000000","ResultParameters":{"ResultParameter":[{"Key":"AccountBalance","Value":"Working Account|KES|700000.00|700000.00|0.00|0.00&Float Account|KES|0.00|0.00|0.00|0.00&Utility Account|KES|228037.00|228037.00|0.00|0.00&Charges Paid Account|KES|-1540.00|-1540.00|0.00|0.00&Organization Settlement Account|KES|0.00|0.00|0.00|0.00"},{"Key":"BOCompletedTime","Value":20200109125710}]}}}`
+	if rec := post(handler, body); rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if len(got.Accounts) != 5 {
+		t.Fatalf("expected 5 accounts, got %d", len(got.Accounts))
+	}
+	working, ok := got.Account("Working Account")
+	if !ok || working.Currency != "KES" || working.Available != 70000000 || working.Available.String() != "700000.00" {
+		t.Errorf("unexpected working account %+v", working)
+	}
+	if charges, _ := got.Account("Charges Paid Account"); charges.Current != -154000 {
+		t.Errorf("expected charges balance -1540.00, got %s", charges.Current)
+	}
+}
+
+// TestParseAccountBalance_Invalid tests that malformed balances are rejected.
+func TestParseAccountBalance_Invalid(t *testing.T) {
+	for _, s := range []string{"Working Account|KES|700000.00", "Working Account|KES|7x|0.00|0.00|0.00", "Working Account|KES|1.005|0.00|0.00|0.00"} {
+		if _, err := types.ParseAccountBalance(s); err == nil {
+			t.Errorf("expected error for %q, got nil", s)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package callback
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// resultHandler decodes a result body with parse, passes it to fn and
+// acknowledges it. Only bodies that cannot be decoded at all are rejected: a
+// result whose typed fields could not all be read still reaches fn, with
+// its ParseError set, as Daraja would only repeat it and the outcome of the
+// payment would be lost.
+func resultHandler[T any](parse func([]byte) (*T, error), fn func(context.Context, *T) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		result, err := parse(body)
+		if result == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		acknowledge(w, fn(r.Context(), result))
+	})
+}
+
+// ResultHandler returns an http.Handler for a ResultURL that passes the
+// untyped result to fn. Use it for commands without a typed handler.
+func ResultHandler(fn func(ctx context.Context, result *types.Result) error) http.Handler {
+	return resultHandler(types.ParseResult, fn)
+}
+
+// TimeoutHandler returns an http.Handler for a QueueTimeOutURL. Daraja calls
+// it when a request timed out in its queue before being processed.
+func TimeoutHandler(fn func(ctx context.Context, result *types.Result) error) http.Handler {
+	return resultHandler(types.ParseResult, fn)
+}
+
+// B2CResultHandler returns an http.Handler for the ResultURL of B2C payments.
+func B2CResultHandler(fn func(ctx context.Context, result *types.B2CResult) error) http.Handler {
+	return resultHandler(types.ParseB2CResult, fn)
+}
+
+// B2BResultHandler returns an http.Handler for the ResultURL of B2B payments.
+func B2BResultHandler(fn func(ctx context.Context, result *types.B2BResult) error) http.Handler {
+	return resultHandler(types.ParseB2BResult, fn)
+}
+
+// ReversalResultHandler returns an http.Handler for the ResultURL of reversals.
+func ReversalResultHandler(fn func(ctx context.Context, result *types.ReversalResult) error) http.Handler {
+	return resultHandler(types.ParseReversalResult, fn)
+}
+
+// TransactionStatusResultHandler returns an http.Handler for the ResultURL of
+// transaction status queries.
+func TransactionStatusResultHandler(fn func(ctx context.Context, result *types.TransactionStatusResult) error) http.Handler {
+	return resultHandler(types.ParseTransactionStatusResult, fn)
+}
+
+// BalanceResultHandler returns an http.Handler for the ResultURL of account
+// balance queries.
+func BalanceResultHandler(fn func(ctx context.Context, result *types.BalanceResult) error) http.Handler {
+	return resultHandler(types.ParseBalanceResult, fn)
+}
+
+// B2BExpressCheckoutHandler returns an http.Handler for the callbackUrl of
+// B2B Express Checkouts.
+func B2BExpressCheckoutHandler(fn func(ctx context.Context, cb *types.B2BExpressCheckoutCallback) error) http.Handler {
+	return resultHandler(types.ParseB2BExpressCheckoutCallback, fn)
+}
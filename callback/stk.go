@@ -0,0 +1,29 @@
+package callback
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// STKPushFunc handles a decoded STK Push callback. Returning an error makes
+// the handler answer with a 500 so the failure is visible on Daraja's side.
+type STKPushFunc func(ctx context.Context, cb *types.STKCallback) error
+
+// STKPushHandler returns an http.Handler for the CallBackURL of STK Push
+// requests. It decodes the callback, passes it to fn and acknowledges it.
+func STKPushHandler(fn STKPushFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := readBody(w, r)
+		if !ok {
+			return
+		}
+		cb, err := types.ParseSTKCallback(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		acknowledge(w, fn(r.Context(), cb))
+	})
+}
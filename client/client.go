@@ -6,31 +6,59 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"sync"
+	"strconv"
+	"time"
 
 	"github.com/freelancer254/mpesa-go/types"
-	"github.com/freelancer254/mpesa-go/utils"
 	"github.com/go-playground/validator/v10"
 )
 
 // Mpesa is the main client for interacting with the M-Pesa Daraja API.
+//
+// An Mpesa holds no per-request state and is safe for concurrent use; the
+// authorization header is attached to each outgoing request individually.
 type Mpesa struct {
-	baseURL  string
-	headers  map[string]string
-	client   *http.Client
-	mu       sync.RWMutex
-	validate *validator.Validate
+	env       Environment
+	baseURL   string
+	client    *http.Client
+	timeout   time.Duration
+	userAgent string
+	validate  *validator.Validate
+	tokens    *tokenCache
+	stk       *stkSigner
+	retry     *RetryPolicy
+
+	normalizePhones bool
 }
 
-// NewMpesa initializes a new Mpesa client.
-func NewMpesa() *Mpesa {
-	return &Mpesa{
-		baseURL:  "https://api.safaricom.co.ke",
-		headers:  make(map[string]string),
-		client:   &http.Client{},
-		validate: validator.New(),
-	}
+// NewMpesa initializes a new Mpesa client. Without options it targets the
+// Production environment with a DefaultTimeout HTTP client.
+//
+//	mpesa := client.NewMpesa(
+//		client.WithEnvironment(client.Sandbox),
+//		client.WithCredentials(consumerKey, consumerSecret),
+//		client.WithTimeout(10*time.Second),
+//	)
+func NewMpesa(opts ...Option) *Mpesa {
+	m := &Mpesa{
+		env:      Production,
+		baseURL:  Production.BaseURL(),
+		client:   &http.Client{Timeout: DefaultTimeout},
+		validate: newValidator(),
+		tokens:   &tokenCache{},
+		stk:      &stkSigner{},
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.timeout > 0 {
+		client := *m.client
+		client.Timeout = m.timeout
+		m.client = &client
+	}
+	return m
 }
 
 // SetBaseURL sets the base URL for testing purposes.
@@ -43,25 +71,24 @@ func (m *Mpesa) BaseURL() string {
 	return m.baseURL
 }
 
-// Headers returns the headers.
-func (m *Mpesa) Headers() map[string]string {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	return m.headers
+// Environment returns the environment the client was configured for.
+func (m *Mpesa) Environment() Environment {
+	return m.env
 }
 
-// setHeaders sets the authorization headers with the provided access token.
-func (m *Mpesa) setHeaders(accessToken string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.headers = map[string]string{
-		"Content-Type":  "application/json",
-		"Authorization": fmt.Sprintf("Bearer %s", accessToken),
+// Headers returns a fresh copy of the headers sent with every API request.
+// The Authorization header is request-scoped and therefore not included.
+func (m *Mpesa) Headers() http.Header {
+	h := make(http.Header)
+	h.Set("Content-Type", "application/json")
+	if m.userAgent != "" {
+		h.Set("User-Agent", m.userAgent)
 	}
+	return h
 }
 
-// doRequest performs an HTTP request with the given method, URL, and payload.
-func (m *Mpesa) doRequest(ctx context.Context, method, url string, payload interface{}) (*http.Response, error) {
+// doRequest performs an HTTP request with the given method, URL, access token and payload.
+func (m *Mpesa) doRequest(ctx context.Context, method, url, accessToken string, payload interface{}) (*http.Response, error) {
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal payload: %w", err)
@@ -72,11 +99,8 @@ func (m *Mpesa) doRequest(ctx context.Context, method, url string, payload inter
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	m.mu.RLock()
-	for k, v := range m.headers {
-		req.Header.Set(k, v)
-	}
-	m.mu.RUnlock()
+	req.Header = m.Headers()
+	req.Header.Set("Authorization", "Bearer "+accessToken)
 
 	resp, err := m.client.Do(req)
 	if err != nil {
@@ -85,6 +109,22 @@ func (m *Mpesa) doRequest(ctx context.Context, method, url string, payload inter
 	return resp, nil
 }
 
+// decodeResponse decodes a successful response into out. Non-2xx responses
+// are returned as a *types.APIError.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return fmt.Errorf("failed to read error response: %w", err)
+		}
+		return types.ParseAPIError(resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
 // GetAccessToken retrieves an OAuth access token using consumer key and secret.
 func (m *Mpesa) GetAccessToken(ctx context.Context, consumerKey string, consumerSecret string) (*types.AccessTokenResponse, error) {
 	url := m.baseURL + "/oauth/v1/generate?grant_type=client_credentials"
@@ -93,6 +133,9 @@ func (m *Mpesa) GetAccessToken(ctx context.Context, consumerKey string, consumer
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.SetBasicAuth(consumerKey, consumerSecret)
+	if m.userAgent != "" {
+		req.Header.Set("User-Agent", m.userAgent)
+	}
 
 	resp, err := m.client.Do(req)
 	if err != nil {
@@ -101,23 +144,28 @@ func (m *Mpesa) GetAccessToken(ctx context.Context, consumerKey string, consumer
 	defer resp.Body.Close()
 
 	var token types.AccessTokenResponse
-	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &token); err != nil {
+		return nil, err
 	}
 	return &token, nil
 }
 
 // STKPush initiates a transaction using STK Push.
 func (m *Mpesa) STKPush(ctx context.Context, payload types.STKPushRequest) (*types.STKPushResponse, error) {
+	m.normalize(&payload)
 	if err := m.validate.Struct(payload); err != nil {
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
+	shortCode, password, timestamp, err := m.stk.sign(payload.BusinessShortCode, payload.Password, payload.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
 	payloadMap := map[string]interface{}{
-		"BusinessShortCode": payload.BusinessShortCode,
-		"Password":          payload.Password,
-		"Timestamp":         utils.GetTimestamp(),
+		"BusinessShortCode": shortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
 		"TransactionType":   "CustomerPayBillOnline",
 		"Amount":            payload.Amount,
 		"PartyA":            payload.PartyA,
@@ -129,26 +177,15 @@ func (m *Mpesa) STKPush(ctx context.Context, payload types.STKPushRequest) (*typ
 	}
 
 	url := m.baseURL + "/mpesa/stkpush/v1/processrequest"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, moneyCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		var errorResp types.STKPushError
-		if err := json.NewDecoder(resp.Body).Decode(&errorResp); err != nil {
-			return nil, fmt.Errorf("failed to decode error response: %w", err)
-		}
-		if err := m.validate.Struct(errorResp); err != nil {
-			return nil, fmt.Errorf("invalid error response: %w", err)
-		}
-		return nil, fmt.Errorf("STK Push failed: %s (code: %s)", errorResp.Body.StkCallback.ResultDesc, errorResp.Body.StkCallback.ResultCode)
-	}
-
 	var response types.STKPushResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -159,24 +196,28 @@ func (m *Mpesa) STKPushQuery(ctx context.Context, payload types.STKPushQueryRequ
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
+	shortCode, password, timestamp, err := m.stk.sign(payload.BusinessShortCode, payload.Password, payload.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+
 	payloadMap := map[string]interface{}{
-		"BusinessShortCode": payload.BusinessShortCode,
-		"Password":          payload.Password,
-		"Timestamp":         utils.GetTimestamp(),
+		"BusinessShortCode": shortCode,
+		"Password":          password,
+		"Timestamp":         timestamp,
 		"CheckoutRequestID": payload.CheckoutRequestID,
 	}
 
 	url := m.baseURL + "/mpesa/stkpushquery/v1/query"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.STKPushQueryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -187,7 +228,6 @@ func (m *Mpesa) RegisterURL(ctx context.Context, payload types.RegisterURLReques
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"ShortCode":       payload.ShortCode,
 		"ResponseType":    payload.ResponseType,
@@ -196,26 +236,26 @@ func (m *Mpesa) RegisterURL(ctx context.Context, payload types.RegisterURLReques
 	}
 
 	url := m.baseURL + "/mpesa/c2b/v2/registerurl"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.RegisterURLResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
 
 // SimulateTransaction simulates a customer transaction for testing.
 func (m *Mpesa) SimulateTransaction(ctx context.Context, payload types.SimulateTransactionRequest) (*types.SimulateTransactionResponse, error) {
+	m.normalize(&payload)
 	if err := m.validate.Struct(payload); err != nil {
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"ShortCode":     payload.ShortCode,
 		"CommandID":     "CustomerPayBillOnline",
@@ -225,15 +265,15 @@ func (m *Mpesa) SimulateTransaction(ctx context.Context, payload types.SimulateT
 	}
 
 	url := m.baseURL + "/mpesa/c2b/v1/simulate"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, moneyCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.SimulateTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -244,7 +284,6 @@ func (m *Mpesa) ReverseTransaction(ctx context.Context, payload types.ReverseTra
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"Initiator":              payload.Initiator,
 		"SecurityCredential":     payload.SecurityCredential,
@@ -260,15 +299,15 @@ func (m *Mpesa) ReverseTransaction(ctx context.Context, payload types.ReverseTra
 	}
 
 	url := m.baseURL + "/mpesa/reversal/v1/request"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, moneyCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.ReverseTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -279,7 +318,6 @@ func (m *Mpesa) QueryTransaction(ctx context.Context, payload types.QueryTransac
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"Initiator":                payload.Initiator,
 		"SecurityCredential":       payload.SecurityCredential,
@@ -295,15 +333,15 @@ func (m *Mpesa) QueryTransaction(ctx context.Context, payload types.QueryTransac
 	}
 
 	url := m.baseURL + "/mpesa/transactionstatus/v1/query"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.QueryTransactionResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -314,7 +352,6 @@ func (m *Mpesa) GetBalance(ctx context.Context, payload types.GetBalanceRequest)
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"Initiator":          payload.Initiator,
 		"SecurityCredential": payload.SecurityCredential,
@@ -327,26 +364,27 @@ func (m *Mpesa) GetBalance(ctx context.Context, payload types.GetBalanceRequest)
 	}
 
 	url := m.baseURL + "/mpesa/accountbalance/v1/query"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.GetBalanceResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
 
-// B2CSend sends funds from paybill to customer.
+// B2CSend sends funds from paybill to customer through the legacy B2C v1 API.
+// Prefer B2CPayment; payload.V3 converts a request.
 func (m *Mpesa) B2CSend(ctx context.Context, payload types.B2CSendRequest) (*types.B2CSendResponse, error) {
+	m.normalize(&payload)
 	if err := m.validate.Struct(payload); err != nil {
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"InitiatorName":      payload.InitiatorName,
 		"SecurityCredential": payload.SecurityCredential,
@@ -361,26 +399,96 @@ func (m *Mpesa) B2CSend(ctx context.Context, payload types.B2CSendRequest) (*typ
 	}
 
 	url := m.baseURL + "/mpesa/b2c/v1/paymentrequest"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, moneyCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.B2CSendResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// B2CPayment sends funds from a shortcode to a customer through the B2C v3
+// API. Unlike B2CSend, the caller picks the OriginatorConversationID, so the
+// result can be matched to the payment even if the acknowledgement is lost,
+// and Daraja deduplicates retries on it. An empty OriginatorConversationID
+// is taken from the context's idempotency key, see WithIdempotencyKey.
+func (m *Mpesa) B2CPayment(ctx context.Context, payload types.B2CPaymentRequest) (*types.B2CSendResponse, error) {
+	if key, ok := IdempotencyKey(ctx); ok && payload.OriginatorConversationID == "" {
+		payload.OriginatorConversationID = key
+	}
+	m.normalize(&payload)
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	payloadMap := map[string]interface{}{
+		"OriginatorConversationID": payload.OriginatorConversationID,
+		"InitiatorName":            payload.InitiatorName,
+		"SecurityCredential":       payload.SecurityCredential,
+		"CommandID":                payload.CommandID,
+		"Amount":                   payload.Amount,
+		"PartyA":                   payload.PartyA,
+		"PartyB":                   payload.PartyB,
+		"Remarks":                  payload.Remarks,
+		"QueueTimeOutURL":          payload.QueueTimeOutURL,
+		"ResultURL":                payload.ResultURL,
+		"Occasion":                 payload.Occasion,
+	}
+
+	url := m.baseURL + "/mpesa/b2c/v3/paymentrequest"
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, dedupedCall)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response types.B2CSendResponse
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
 
 // B2BSend sends funds from paybill to paybill.
 func (m *Mpesa) B2BSend(ctx context.Context, payload types.B2BSendRequest) (*types.B2BSendResponse, error) {
+	m.normalize(&payload)
 	if err := m.validate.Struct(payload); err != nil {
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
+	return m.b2b(ctx, "/mpesa/b2b/v1/paymentrequest", payload.AccessToken, b2bPayload(payload))
+}
+
+// BusinessPayBill pays a paybill from a shortcode against
+// payload.AccountReference. The outcome is posted to payload.ResultURL.
+func (m *Mpesa) BusinessPayBill(ctx context.Context, payload types.BusinessPayBillRequest) (*types.B2BSendResponse, error) {
+	m.normalize(&payload)
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	return m.b2b(ctx, "/mpesa/b2b/v1/paymentrequest", payload.AccessToken, b2bPayload(payload.B2B()))
+}
+
+// BusinessBuyGoods pays a till from a shortcode. The outcome is posted to
+// payload.ResultURL.
+func (m *Mpesa) BusinessBuyGoods(ctx context.Context, payload types.BusinessBuyGoodsRequest) (*types.B2BSendResponse, error) {
+	m.normalize(&payload)
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	return m.b2b(ctx, "/mpesa/b2b/v1/paymentrequest", payload.AccessToken, b2bPayload(payload.B2B()))
+}
+
+// b2bPayload builds the body of a B2B payment request. The optional
+// AccountReference and Requester are left out when empty.
+func b2bPayload(payload types.B2BSendRequest) map[string]interface{} {
 	payloadMap := map[string]interface{}{
 		"Initiator":              payload.Initiator,
 		"SecurityCredential":     payload.SecurityCredential,
@@ -391,33 +499,129 @@ func (m *Mpesa) B2BSend(ctx context.Context, payload types.B2BSendRequest) (*typ
 		"PartyA":                 payload.PartyA,
 		"PartyB":                 payload.PartyB,
 		"Remarks":                payload.Remarks,
-		"AccountReference":       payload.AccountReference,
-		"Requester":              payload.Requester,
 		"QueueTimeOutURL":        payload.QueueTimeOutURL,
 		"ResultURL":              payload.ResultURL,
 	}
+	if payload.AccountReference != "" {
+		payloadMap["AccountReference"] = payload.AccountReference
+	}
+	if payload.Requester != "" {
+		payloadMap["Requester"] = payload.Requester
+	}
+	return payloadMap
+}
+
+// RemitTax pays tax to KRA against the payment registration number in
+// payload.PRN. The outcome is posted to payload.ResultURL; decode it with
+// types.ParseRemitTaxResult or callback.B2BResultHandler.
+func (m *Mpesa) RemitTax(ctx context.Context, payload types.RemitTaxRequest) (*types.B2BSendResponse, error) {
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
 
-	url := m.baseURL + "/mpesa/b2b/v1/paymentrequest"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	payloadMap := map[string]interface{}{
+		"Initiator":              payload.Initiator,
+		"SecurityCredential":     payload.SecurityCredential,
+		"CommandID":              "PayTaxToKRA",
+		"SenderIdentifierType":   types.IdentifierShortCode,
+		"RecieverIdentifierType": types.IdentifierShortCode,
+		"Amount":                 payload.Amount,
+		"PartyA":                 payload.PartyA,
+		"PartyB":                 types.KRAShortCode,
+		"AccountReference":       payload.PRN,
+		"Remarks":                payload.Remarks,
+		"QueueTimeOutURL":        payload.QueueTimeOutURL,
+		"ResultURL":              payload.ResultURL,
+	}
+
+	return m.b2b(ctx, "/mpesa/b2b/v1/remittax", payload.AccessToken, payloadMap)
+}
+
+// b2b posts a business to business payment to path and decodes the acknowledgement.
+func (m *Mpesa) b2b(ctx context.Context, path, accessToken string, payloadMap map[string]interface{}) (*types.B2BSendResponse, error) {
+	url := m.baseURL + path
+	resp, err := m.send(ctx, http.MethodPost, url, accessToken, payloadMap, moneyCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.B2BSendResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// B2BExpressCheckout pushes a USSD payment prompt to the operator of another
+// business's till. Daraja only acknowledges the push here; the outcome is
+// posted to payload.CallbackURL.
+func (m *Mpesa) B2BExpressCheckout(ctx context.Context, payload types.B2BExpressCheckoutRequest) (*types.B2BExpressCheckoutResponse, error) {
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	payloadMap := map[string]interface{}{
+		"primaryShortCode":  payload.PrimaryShortCode,
+		"receiverShortCode": payload.ReceiverShortCode,
+		"amount":            strconv.FormatInt(payload.Amount.Shillings(), 10), // sent as a string
+		"paymentRef":        payload.PaymentRef,
+		"callbackUrl":       payload.CallbackURL,
+		"partnerName":       payload.PartnerName,
+		"RequestRefID":      payload.RequestRefID,
+	}
+
+	url := m.baseURL + "/v1/ussdpush/get-msisdn"
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, moneyCall)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response types.B2BExpressCheckoutResponse
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GenerateQRCode generates a dynamic M-Pesa QR code. The image is returned
+// base64 encoded in QRCode; use the response's PNG method to decode it.
+func (m *Mpesa) GenerateQRCode(ctx context.Context, payload types.QRCodeRequest) (*types.QRCodeResponse, error) {
+	if err := m.validate.Struct(payload); err != nil {
+		return nil, fmt.Errorf("invalid payload: %w", err)
+	}
+
+	payloadMap := map[string]interface{}{
+		"MerchantName": payload.MerchantName,
+		"RefNo":        payload.RefNo,
+		"Amount":       payload.Amount,
+		"TrxCode":      payload.TrxCode,
+		"CPI":          payload.CPI,
+		"Size":         payload.Size,
+	}
+
+	url := m.baseURL + "/mpesa/qrcode/v1/generate"
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response types.QRCodeResponse
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
 
 // RegisterPullAPI registers the pull transaction API.
 func (m *Mpesa) RegisterPullAPI(ctx context.Context, payload types.RegisterPullAPIRequest) (*types.RegisterPullAPIResponse, error) {
+	m.normalize(&payload)
 	if err := m.validate.Struct(payload); err != nil {
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"ShortCode":       payload.ShortCode,
 		"NominatedNumber": payload.NominatedNumber,
@@ -425,15 +629,15 @@ func (m *Mpesa) RegisterPullAPI(ctx context.Context, payload types.RegisterPullA
 	}
 
 	url := m.baseURL + "/pulltransactions/v1/register"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.RegisterPullAPIResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -444,7 +648,6 @@ func (m *Mpesa) PullTransactions(ctx context.Context, payload types.PullTransact
 		return nil, fmt.Errorf("invalid payload: %w", err)
 	}
 
-	m.setHeaders(payload.AccessToken)
 	payloadMap := map[string]interface{}{
 		"ShortCode":   payload.ShortCode,
 		"StartDate":   payload.StartDate,
@@ -453,15 +656,15 @@ func (m *Mpesa) PullTransactions(ctx context.Context, payload types.PullTransact
 	}
 
 	url := m.baseURL + "/pulltransactions/v1/query"
-	resp, err := m.doRequest(ctx, http.MethodPost, url, payloadMap)
+	resp, err := m.send(ctx, http.MethodPost, url, payload.AccessToken, payloadMap, readCall)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var response types.PullTransactionsResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := decodeResponse(resp, &response); err != nil {
+		return nil, err
 	}
 	return &response, nil
 }
@@ -4,13 +4,18 @@ package client_test
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
+	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/freelancer254/mpesa-go/client"
 	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
 )
 
 // mockServer creates a test HTTP server with a custom handler.
@@ -26,6 +31,15 @@ func mockServer(t *testing.T, statusCode int, response interface{}) *httptest.Se
 	}))
 }
 
+// expectPayload returns an echoServer check that the request body is exactly want.
+func expectPayload(t *testing.T, want map[string]interface{}) func(body map[string]interface{}) {
+	return func(body map[string]interface{}) {
+		if !reflect.DeepEqual(body, want) {
+			t.Errorf("unexpected payload\n got: %v\nwant: %v", body, want)
+		}
+	}
+}
+
 // TestNewMpesa tests the initialization of the Mpesa client.
 func TestNewMpesa(t *testing.T) {
 	mpesa := client.NewMpesa()
@@ -35,8 +49,8 @@ func TestNewMpesa(t *testing.T) {
 	if mpesa.BaseURL() != "https://api.safaricom.co.ke" {
 		t.Errorf("expected baseURL to be %s, got %s", "https://api.safaricom.co.ke", mpesa.BaseURL())
 	}
-	if len(mpesa.Headers()) != 0 {
-		t.Errorf("expected headers to be empty, got %v", mpesa.Headers())
+	if got := mpesa.Headers().Get("Authorization"); got != "" {
+		t.Errorf("expected no shared Authorization header, got %s", got)
 	}
 }
 
@@ -74,7 +88,7 @@ func TestGetAccessToken_Error(t *testing.T) {
 	mpesa := client.NewMpesa()
 	mpesa.SetBaseURL(server.URL)
 
-	err, _ := mpesa.GetAccessToken(ctx, "invalid_key", "invalid_secret")
+	_, err := mpesa.GetAccessToken(ctx, "invalid_key", "invalid_secret")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -100,7 +114,8 @@ func TestSTKPush_Success(t *testing.T) {
 		AccessToken:       "test-token",
 		BusinessShortCode: "123456",
 		Password:          "encoded_password",
-		Amount:            "100",
+		Timestamp:         "20191219102115",
+		Amount:            100 * types.Shilling,
 		PartyA:            "254700000000",
 		PartyB:            "123456",
 		PhoneNumber:       "254700000000",
@@ -186,7 +201,7 @@ func TestSimulateTransaction_Success(t *testing.T) {
 	payload := types.SimulateTransactionRequest{
 		AccessToken:   "test-token",
 		ShortCode:     "123456",
-		Amount:        "100",
+		Amount:        100 * types.Shilling,
 		Msisdn:        "254700000000",
 		BillRefNumber: "TEST123",
 	}
@@ -289,7 +304,7 @@ func TestB2CSend_Success(t *testing.T) {
 		InitiatorName:      "test-initiator",
 		SecurityCredential: "credential",
 		CommandID:          "PromotionPayment",
-		Amount:             "100",
+		Amount:             100 * types.Shilling,
 		PartyA:             "123456",
 		PartyB:             "254700000000",
 		Remarks:            "Test B2C",
@@ -307,6 +322,42 @@ func TestB2CSend_Success(t *testing.T) {
 	}
 }
 
+// TestB2CPayment_Payload tests that B2CPayment sends the v3 payload with the caller's OriginatorConversationID.
+func TestB2CPayment_Payload(t *testing.T) {
+	server := echoServer(t, types.B2CSendResponse{OriginatorConversationID: "payout-42", ResponseCode: "0"}, expectPayload(t, map[string]interface{}{
+		"OriginatorConversationID": "payout-42",
+		"InitiatorName":            "test-initiator",
+		"SecurityCredential":       "credential",
+		"CommandID":                "SalaryPayment",
+		"Amount":                   float64(100),
+		"PartyA":                   "123456",
+		"PartyB":                   "254700000000",
+		"Remarks":                  "Salary",
+		"QueueTimeOutURL":          "https://timeout.example.com",
+		"ResultURL":                "https://result.example.com",
+		"Occasion":                 "June",
+	}))
+	defer server.Close()
+
+	payload := types.B2CPaymentRequest{
+		AccessToken:              "test-token",
+		OriginatorConversationID: "payout-42",
+		InitiatorName:            "test-initiator",
+		SecurityCredential:       "credential",
+		CommandID:                types.SalaryPayment,
+		Amount:                   100 * types.Shilling,
+		PartyA:                   "123456",
+		PartyB:                   "254700000000",
+		Remarks:                  "Salary",
+		QueueTimeOutURL:          "https://timeout.example.com",
+		ResultURL:                "https://result.example.com",
+		Occasion:                 "June",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).B2CPayment(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
 // TestB2BSend_Success tests the B2BSend method with a successful response.
 func TestB2BSend_Success(t *testing.T) {
 	ctx := context.Background()
@@ -329,7 +380,7 @@ func TestB2BSend_Success(t *testing.T) {
 		CommandID:              "BusinessPayment",
 		SenderIdentifierType:   "4",
 		ReceiverIdentifierType: "4",
-		Amount:                 "100",
+		Amount:                 100 * types.Shilling,
 		PartyA:                 "123456",
 		PartyB:                 "654321",
 		Remarks:                "Test B2B",
@@ -389,12 +440,12 @@ func TestPullTransactions_Success(t *testing.T) {
 		Transactions: []types.Transaction{
 			{
 				TransactionID:    "yzlyrEsRG1",
-				TrxDate:          "2020-08-05T10:13:00Z",
-				Msisdn:           72200000,
+				TrxDate:          time.Date(2020, 8, 5, 10, 13, 0, 0, utils.Nairobi),
+				Msisdn:           "2547***123",
 				Sender:           "UAT2",
-				TransactionType:  "c2b-pay-bill-debit",
+				TransactionType:  types.TransactionPayBill,
 				BillReference:    "37207636392",
-				Amount:           "168.00",
+				Amount:           16800,
 				OrganizationName: "Daraja Pull API Test",
 			},
 		},
@@ -423,6 +474,32 @@ func TestPullTransactions_Success(t *testing.T) {
 	if result.Transactions[0].TransactionID != response.Transactions[0].TransactionID {
 		t.Errorf("expected transaction ID %s, got %s", response.Transactions[0].TransactionID, result.Transactions[0].TransactionID)
 	}
+	if tx := result.Transactions[0]; !tx.TrxDate.Equal(response.Transactions[0].TrxDate) || tx.Amount != 16800 || !tx.Masked() {
+		t.Errorf("unexpected transaction %+v", tx)
+	}
+}
+
+// TestTransaction_UnmarshalJSON tests decoding the numbers and strings Daraja sends interchangeably.
+func TestTransaction_UnmarshalJSON(t *testing.T) {
+	data := `{"transactionId":"yzlyrEsRG1","trxDate":"2020-08-05T10:13:00Z","msisdn":254722000000,"sender":"UAT2",` +
+		`"transactiontype":"c2b-buy-goods-debit","billreference":"","amount":168,"organizationname":"Daraja Pull API Test"}`
+	var tx types.Transaction
+	if err := json.Unmarshal([]byte(data), &tx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if tx.Msisdn != "254722000000" || tx.Amount != 16800 || tx.TransactionType != types.TransactionBuyGoods || tx.Masked() {
+		t.Errorf("unexpected transaction %+v", tx)
+	}
+	if want := time.Date(2020, 8, 5, 10, 13, 0, 0, utils.Nairobi); !tx.TrxDate.Equal(want) {
+		t.Errorf("expected %v, got %v", want, tx.TrxDate)
+	}
+	if string(tx.Raw) != data {
+		t.Errorf("expected the raw transaction, got %s", tx.Raw)
+	}
+
+	if err := json.Unmarshal([]byte(`{"transactionId":"x","amount":"12.345"}`), &tx); err == nil {
+		t.Error("expected an error for an inexact amount")
+	}
 }
 
 // TestConcurrentAccess tests concurrent access to the Mpesa client.
@@ -438,7 +515,8 @@ func TestConcurrentAccess(t *testing.T) {
 		AccessToken:       "test-token",
 		BusinessShortCode: "123456",
 		Password:          "encoded_password",
-		Amount:            "100",
+		Timestamp:         "20191219102115",
+		Amount:            100 * types.Shilling,
 		PartyA:            "254700000000",
 		PartyB:            "123456",
 		PhoneNumber:       "254700000000",
@@ -459,3 +537,272 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 	wg.Wait()
 }
+
+// TestConcurrentAccess_TokenIsolation tests that concurrent requests with different
+// access tokens never send each other's Authorization header. Run with -race.
+func TestConcurrentAccess_TokenIsolation(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		if got, want := r.Header.Get("Authorization"), "Bearer "+body["Remarks"].(string); got != want {
+			t.Errorf("expected Authorization %q, got %q", want, got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.B2CSendResponse{ResponseCode: "0"})
+	}))
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(token string) {
+			defer wg.Done()
+			payload := types.B2CSendRequest{
+				AccessToken:        token,
+				InitiatorName:      "test-initiator",
+				SecurityCredential: "credential",
+				CommandID:          "BusinessPayment",
+				Amount:             100 * types.Shilling,
+				PartyA:             "123456",
+				PartyB:             "254700000000",
+				Remarks:            token,
+				QueueTimeOutURL:    "https://timeout.example.com",
+				ResultURL:          "https://result.example.com",
+				Occasion:           "Test",
+			}
+			if _, err := mpesa.B2CSend(ctx, payload); err != nil {
+				t.Errorf("concurrent B2CSend failed: %v", err)
+			}
+		}("token-" + strconv.Itoa(i))
+	}
+	wg.Wait()
+}
+
+// TestAPIError_NonSuccessStatus tests that non-2xx responses are returned as typed API errors.
+func TestAPIError_NonSuccessStatus(t *testing.T) {
+	ctx := context.Background()
+	server := mockServer(t, http.StatusBadRequest, map[string]string{
+		"requestId":    "11728-2929992-1",
+		"errorCode":    "400.002.02",
+		"errorMessage": "Bad Request - Invalid PartyA",
+	})
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	payload := types.GetBalanceRequest{
+		AccessToken:        "test-token",
+		Initiator:          "test-initiator",
+		SecurityCredential: "credential",
+		PartyA:             "123456",
+		IdentifierType:     "4",
+		Remarks:            "Test balance",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+	}
+
+	_, err := mpesa.GetBalance(ctx, payload)
+	var apiErr *types.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected *types.APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusBadRequest || apiErr.ErrorCode != "400.002.02" || apiErr.RequestID != "11728-2929992-1" {
+		t.Errorf("unexpected API error %+v", apiErr)
+	}
+}
+
+// TestAPIError_Sentinels tests that common Daraja errors match their sentinel errors.
+func TestAPIError_Sentinels(t *testing.T) {
+	tests := []struct {
+		status   int
+		code     string
+		message  string
+		sentinel error
+	}{
+		{http.StatusNotFound, "404.001.03", "Invalid Access Token", types.ErrInvalidAccessToken},
+		{http.StatusBadRequest, "400.002.02", "Bad Request - Invalid BusinessShortCode", types.ErrInvalidShortCode},
+		{http.StatusInternalServerError, "500.001.1001", "The transaction is being processed", types.ErrTransactionProcessing},
+		{http.StatusInternalServerError, "500.001.1001", "Duplicate OriginatorConversationID.", types.ErrDuplicateRequest},
+		{http.StatusInternalServerError, "500.001.1001", "The balance is insufficient for the transaction", types.ErrInsufficientBalance},
+		{http.StatusBadRequest, "400.008.01", "Invalid Authentication passed", types.ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		server := mockServer(t, tt.status, map[string]string{"errorCode": tt.code, "errorMessage": tt.message})
+		mpesa := client.NewMpesa()
+		mpesa.SetBaseURL(server.URL)
+
+		payload := stkPayload()
+		payload.AccessToken = "test-token"
+		_, err := mpesa.STKPush(context.Background(), payload)
+		if !errors.Is(err, tt.sentinel) {
+			t.Errorf("%s: expected %v, got %v", tt.message, tt.sentinel, err)
+		}
+		server.Close()
+	}
+}
+
+// TestB2BExpressCheckout_Payload tests that B2BExpressCheckout sends its amount as a string of whole shillings.
+func TestB2BExpressCheckout_Payload(t *testing.T) {
+	server := echoServer(t, types.B2BExpressCheckoutResponse{Code: "0", Status: "USSD Initiated Successfully"}, expectPayload(t, map[string]interface{}{
+		"primaryShortCode":  "000001",
+		"receiverShortCode": "000002",
+		"amount":            "100",
+		"paymentRef":        "INV-12",
+		"callbackUrl":       "https://callback.example.com",
+		"partnerName":       "Vendor",
+		"RequestRefID":      "550e8400-e29b-41d4-a716-446655440000",
+	}))
+	defer server.Close()
+
+	payload := types.B2BExpressCheckoutRequest{
+		AccessToken:       "test-token",
+		PrimaryShortCode:  "000001",
+		ReceiverShortCode: "000002",
+		Amount:            100 * types.Shilling,
+		PaymentRef:        "INV-12",
+		CallbackURL:       "https://callback.example.com",
+		PartnerName:       "Vendor",
+		RequestRefID:      "550e8400-e29b-41d4-a716-446655440000",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).B2BExpressCheckout(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestGenerateQRCode_Payload tests the payload sent by GenerateQRCode.
+func TestGenerateQRCode_Payload(t *testing.T) {
+	server := echoServer(t, types.QRCodeResponse{ResponseCode: "AG_20191219_000043fdf61864fe9ff5"}, expectPayload(t, map[string]interface{}{
+		"MerchantName": "TEST SUPERMARKET",
+		"RefNo":        "Invoice Test",
+		"Amount":       float64(1),
+		"TrxCode":      "BG",
+		"CPI":          "373132",
+		"Size":         "300",
+	}))
+	defer server.Close()
+
+	payload := types.QRCodeRequest{
+		AccessToken:  "test-token",
+		MerchantName: "TEST SUPERMARKET",
+		RefNo:        "Invoice Test",
+		Amount:       1 * types.Shilling,
+		TrxCode:      types.QRBuyGoods,
+		CPI:          "373132",
+		Size:         "300",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).GenerateQRCode(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestRemitTax_Payload tests that RemitTax pays the KRA shortcode with the PRN as the account reference.
+func TestRemitTax_Payload(t *testing.T) {
+	server := echoServer(t, types.B2BSendResponse{ResponseCode: "0"}, expectPayload(t, map[string]interface{}{
+		"Initiator":              "test-initiator",
+		"SecurityCredential":     "credential",
+		"CommandID":              "PayTaxToKRA",
+		"SenderIdentifierType":   "4",
+		"RecieverIdentifierType": "4",
+		"Amount":                 float64(239),
+		"PartyA":                 "888880",
+		"PartyB":                 "572572",
+		"AccountReference":       "2024123456789",
+		"Remarks":                "Tax",
+		"QueueTimeOutURL":        "https://timeout.example.com",
+		"ResultURL":              "https://result.example.com",
+	}))
+	defer server.Close()
+
+	payload := types.RemitTaxRequest{
+		AccessToken:        "test-token",
+		Initiator:          "test-initiator",
+		SecurityCredential: "credential",
+		Amount:             239 * types.Shilling,
+		PartyA:             "888880",
+		PRN:                "2024123456789",
+		Remarks:            "Tax",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).RemitTax(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestBusinessPayBill_Payload tests that BusinessPayBill pays a shortcode with an account reference.
+func TestBusinessPayBill_Payload(t *testing.T) {
+	server := echoServer(t, types.B2BSendResponse{ResponseCode: "0"}, expectPayload(t, map[string]interface{}{
+		"Initiator":              "test-initiator",
+		"SecurityCredential":     "credential",
+		"CommandID":              "BusinessPayBill",
+		"SenderIdentifierType":   "4",
+		"RecieverIdentifierType": "4",
+		"Amount":                 float64(500),
+		"PartyA":                 "600000",
+		"PartyB":                 "888880",
+		"AccountReference":       "ACC-12",
+		"Requester":              "254700000000",
+		"Remarks":                "Rent",
+		"QueueTimeOutURL":        "https://timeout.example.com",
+		"ResultURL":              "https://result.example.com",
+	}))
+	defer server.Close()
+
+	payload := types.BusinessPayBillRequest{
+		AccessToken:        "test-token",
+		Initiator:          "test-initiator",
+		SecurityCredential: "credential",
+		Amount:             500 * types.Shilling,
+		PartyA:             "600000",
+		PartyB:             "888880",
+		AccountReference:   "ACC-12",
+		Remarks:            "Rent",
+		Requester:          "254700000000",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).BusinessPayBill(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestBusinessBuyGoods_Payload tests that BusinessBuyGoods pays a till, leaving out the empty
+// account reference and requester.
+func TestBusinessBuyGoods_Payload(t *testing.T) {
+	server := echoServer(t, types.B2BSendResponse{ResponseCode: "0"}, expectPayload(t, map[string]interface{}{
+		"Initiator":              "test-initiator",
+		"SecurityCredential":     "credential",
+		"CommandID":              "BusinessBuyGoods",
+		"SenderIdentifierType":   "4",
+		"RecieverIdentifierType": "2",
+		"Amount":                 float64(200),
+		"PartyA":                 "600000",
+		"PartyB":                 "373132",
+		"Remarks":                "Supplies",
+		"QueueTimeOutURL":        "https://timeout.example.com",
+		"ResultURL":              "https://result.example.com",
+	}))
+	defer server.Close()
+
+	payload := types.BusinessBuyGoodsRequest{
+		AccessToken:        "test-token",
+		Initiator:          "test-initiator",
+		SecurityCredential: "credential",
+		Amount:             200 * types.Shilling,
+		PartyA:             "600000",
+		PartyB:             "373132",
+		Remarks:            "Supplies",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).BusinessBuyGoods(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
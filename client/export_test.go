@@ -0,0 +1,13 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+// SetTokenRefreshTimeout replaces the token refresh timeout for the rest of the test.
+func SetTokenRefreshTimeout(t *testing.T, timeout time.Duration) {
+	previous := tokenRefreshTimeout
+	tokenRefreshTimeout = timeout
+	t.Cleanup(func() { tokenRefreshTimeout = previous })
+}
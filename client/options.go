@@ -0,0 +1,129 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Environment selects the Daraja deployment the client talks to.
+type Environment string
+
+const (
+	// Production is the live Daraja API.
+	Production Environment = "production"
+	// Sandbox is the Daraja test environment.
+	Sandbox Environment = "sandbox"
+)
+
+// DefaultTimeout is the HTTP timeout used unless WithHTTPClient or WithTimeout is given.
+const DefaultTimeout = 30 * time.Second
+
+// BaseURL returns the API base URL of the environment, or "" for an
+// unknown environment.
+func (e Environment) BaseURL() string {
+	switch e {
+	case Sandbox:
+		return "https://sandbox.safaricom.co.ke"
+	case Production:
+		return "https://api.safaricom.co.ke"
+	}
+	return ""
+}
+
+// Option configures an Mpesa client created by NewMpesa.
+type Option func(*Mpesa)
+
+// ParseEnvironment parses "sandbox" or "production", in any case, e.g. from
+// configuration.
+func ParseEnvironment(s string) (Environment, error) {
+	env := Environment(strings.ToLower(strings.TrimSpace(s)))
+	if env.BaseURL() == "" {
+		return "", fmt.Errorf("unknown environment %q, want %q or %q", s, Sandbox, Production)
+	}
+	return env, nil
+}
+
+// WithEnvironment selects the Sandbox or Production environment. Parse
+// values from configuration with ParseEnvironment first; any other value is
+// a programming error and panics rather than guess which one was meant.
+func WithEnvironment(env Environment) Option {
+	return func(m *Mpesa) {
+		if env.BaseURL() == "" {
+			panic(fmt.Sprintf("client: unknown environment %q, want %q or %q", env, Sandbox, Production))
+		}
+		m.env = env
+		m.baseURL = env.BaseURL()
+	}
+}
+
+// WithBaseURL overrides the API base URL, e.g. to point at a local fake server.
+func WithBaseURL(url string) Option {
+	return func(m *Mpesa) {
+		m.baseURL = url
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for all requests.
+func WithHTTPClient(client *http.Client) Option {
+	return func(m *Mpesa) {
+		m.client = client
+	}
+}
+
+// WithTimeout sets the timeout of the HTTP client, including one given with WithHTTPClient.
+func WithTimeout(timeout time.Duration) Option {
+	return func(m *Mpesa) {
+		m.timeout = timeout
+	}
+}
+
+// WithCredentials sets the consumer key and secret used to obtain access tokens.
+func WithCredentials(consumerKey, consumerSecret string) Option {
+	return func(m *Mpesa) {
+		m.tokens.setCredentials(consumerKey, consumerSecret)
+	}
+}
+
+// WithPasskey configures the Lipa Na M-Pesa passkey for a shortcode, see SetPasskey.
+func WithPasskey(shortCode, passkey string) Option {
+	return func(m *Mpesa) {
+		m.SetPasskey(shortCode, passkey)
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(m *Mpesa) {
+		m.userAgent = userAgent
+	}
+}
+
+// WithValidator sets the validator used to check request payloads. The
+// client's validation tags are registered on it, see RegisterValidations.
+func WithValidator(validate *validator.Validate) Option {
+	return func(m *Mpesa) {
+		// Registering the client's fixed tags cannot fail.
+		_ = RegisterValidations(validate)
+		m.validate = validate
+	}
+}
+
+// WithPhoneNormalization rewrites phone numbers in any common Kenyan format,
+// e.g. 0712 345 678 or +254712345678, into 2547XXXXXXXX form before requests
+// are validated and sent. See phone.Normalize.
+func WithPhoneNormalization() Option {
+	return func(m *Mpesa) {
+		m.normalizePhones = true
+	}
+}
+
+// WithRetryPolicy sets the retry policy, see SetRetryPolicy.
+func WithRetryPolicy(policy *RetryPolicy) Option {
+	return func(m *Mpesa) {
+		m.retry = policy
+	}
+}
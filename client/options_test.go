@@ -0,0 +1,86 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// TestNewMpesa_Options tests that functional options configure the client.
+func TestNewMpesa_Options(t *testing.T) {
+	mpesa := client.NewMpesa(
+		client.WithEnvironment(client.Sandbox),
+		client.WithUserAgent("payments-service/1.0"),
+	)
+	if mpesa.Environment() != client.Sandbox {
+		t.Errorf("expected environment %s, got %s", client.Sandbox, mpesa.Environment())
+	}
+	if mpesa.BaseURL() != "https://sandbox.safaricom.co.ke" {
+		t.Errorf("expected baseURL to be %s, got %s", "https://sandbox.safaricom.co.ke", mpesa.BaseURL())
+	}
+	if got := mpesa.Headers().Get("User-Agent"); got != "payments-service/1.0" {
+		t.Errorf("expected User-Agent %s, got %s", "payments-service/1.0", got)
+	}
+}
+
+// TestWithEnvironment_Unknown tests that an unknown environment panics instead of defaulting to production.
+func TestWithEnvironment_Unknown(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unknown environment")
+		}
+	}()
+	client.NewMpesa(client.WithEnvironment("Sandbox"))
+}
+
+// TestParseEnvironment tests parsing environments from configuration.
+func TestParseEnvironment(t *testing.T) {
+	if env, err := client.ParseEnvironment(" Sandbox "); err != nil || env != client.Sandbox {
+		t.Errorf("expected sandbox, got %q, %v", env, err)
+	}
+	if env, err := client.ParseEnvironment("PRODUCTION"); err != nil || env != client.Production {
+		t.Errorf("expected production, got %q, %v", env, err)
+	}
+	if _, err := client.ParseEnvironment("staging"); err == nil {
+		t.Error("expected an error for an unknown environment")
+	}
+}
+
+// TestNewMpesa_CredentialsAndTimeout tests credentials and timeout options against a server.
+func TestNewMpesa_CredentialsAndTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/v1/generate" {
+			if key, secret, _ := r.BasicAuth(); key != "consumer_key" || secret != "consumer_secret" {
+				t.Errorf("unexpected credentials %s:%s", key, secret)
+			}
+			w.Write([]byte(`{"access_token":"token","expires_in":"3599"}`))
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	mpesa := client.NewMpesa(
+		client.WithBaseURL(server.URL),
+		client.WithHTTPClient(&http.Client{}),
+		client.WithCredentials("consumer_key", "consumer_secret"),
+		client.WithTimeout(20*time.Millisecond),
+	)
+	if _, err := mpesa.Token(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	payload := types.RegisterPullAPIRequest{
+		ShortCode:       "600000",
+		NominatedNumber: "254700000000",
+		CallBackURL:     "https://callback.example.com",
+	}
+	if _, err := mpesa.RegisterPullAPI(context.Background(), payload); err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+}
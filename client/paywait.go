@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// STKCallbacks routes STK Push callbacks to PayAndWait calls. Mount
+// callback.STKPushHandler(callbacks.Deliver) on the CallBackURL and pass the
+// same STKCallbacks in PayAndWaitOptions. Callbacks that arrive before
+// PayAndWait starts waiting are kept for a while, so none are missed.
+type STKCallbacks struct {
+	mu       sync.Mutex
+	waiters  map[string]chan *types.STKCallback
+	received map[string]stkReceived
+}
+
+// stkReceived is a callback kept until someone waits for it.
+type stkReceived struct {
+	callback *types.STKCallback
+	at       time.Time
+}
+
+// stkCallbackTTL is how long unclaimed callbacks are kept.
+const stkCallbackTTL = 10 * time.Minute
+
+// NewSTKCallbacks returns an empty STKCallbacks.
+func NewSTKCallbacks() *STKCallbacks {
+	return &STKCallbacks{
+		waiters:  make(map[string]chan *types.STKCallback),
+		received: make(map[string]stkReceived),
+	}
+}
+
+// Deliver hands a callback to the PayAndWait waiting for it; it matches
+// callback.STKPushFunc.
+func (s *STKCallbacks) Deliver(ctx context.Context, cb *types.STKCallback) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.waiters[cb.CheckoutRequestID]; ok {
+		delete(s.waiters, cb.CheckoutRequestID)
+		ch <- cb
+		return nil
+	}
+	now := time.Now()
+	for id, r := range s.received {
+		if now.Sub(r.at) > stkCallbackTTL {
+			delete(s.received, id)
+		}
+	}
+	s.received[cb.CheckoutRequestID] = stkReceived{callback: cb, at: now}
+	return nil
+}
+
+// wait returns a channel that receives the callback for checkoutRequestID,
+// and a function to stop waiting.
+func (s *STKCallbacks) wait(checkoutRequestID string) (<-chan *types.STKCallback, func()) {
+	ch := make(chan *types.STKCallback, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.received[checkoutRequestID]; ok {
+		delete(s.received, checkoutRequestID)
+		ch <- r.callback
+	} else {
+		s.waiters[checkoutRequestID] = ch
+	}
+	return ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.waiters[checkoutRequestID] == ch {
+			delete(s.waiters, checkoutRequestID)
+		}
+	}
+}
+
+// PayAndWaitOptions tunes PayAndWait. The zero value polls without callbacks.
+type PayAndWaitOptions struct {
+	// Callbacks, if set, delivers the STK callback as soon as it arrives.
+	Callbacks *STKCallbacks
+	// InitialPollDelay is the wait before the first status query; zero means 5s.
+	InitialPollDelay time.Duration
+	// MaxPollDelay caps the doubling delay between queries; zero means 30s.
+	MaxPollDelay time.Duration
+}
+
+// PayAndWait initiates an STK Push and waits for its final outcome, racing
+// the callback (if Callbacks is set) against STKPushQuery polls with
+// exponential backoff. "Transaction is being processed" answers, rate limits
+// and network errors while polling are treated as pending. It returns when a
+// final result is known, or with ctx.Err() when ctx is done first.
+func (m *Mpesa) PayAndWait(ctx context.Context, payload types.STKPushRequest, opts *PayAndWaitOptions) (*types.STKOutcome, error) {
+	if opts == nil {
+		opts = &PayAndWaitOptions{}
+	}
+	delay, maxDelay := opts.InitialPollDelay, opts.MaxPollDelay
+	if delay <= 0 {
+		delay = 5 * time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+
+	push, err := m.STKPush(ctx, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var callbacks <-chan *types.STKCallback
+	if opts.Callbacks != nil {
+		ch, stop := opts.Callbacks.wait(push.CheckoutRequestID)
+		defer stop()
+		callbacks = ch
+	}
+
+	query := types.STKPushQueryRequest{
+		AccessToken:       payload.AccessToken,
+		BusinessShortCode: payload.BusinessShortCode,
+		Password:          payload.Password,
+		Timestamp:         payload.Timestamp,
+		CheckoutRequestID: push.CheckoutRequestID,
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case cb := <-callbacks:
+			return &types.STKOutcome{
+				Status:            types.STKStatusFromResultCode(cb.ResultCode),
+				MerchantRequestID: cb.MerchantRequestID,
+				CheckoutRequestID: cb.CheckoutRequestID,
+				ResultCode:        cb.ResultCode,
+				ResultDesc:        cb.ResultDesc,
+				Callback:          cb,
+			}, nil
+		case <-timer.C:
+		}
+
+		resp, err := m.STKPushQuery(ctx, query)
+		switch {
+		case err == nil && types.STKStatusFromResultCode(resp.ResultCode) != types.STKPending:
+			return &types.STKOutcome{
+				Status:            types.STKStatusFromResultCode(resp.ResultCode),
+				MerchantRequestID: resp.MerchantRequestID,
+				CheckoutRequestID: push.CheckoutRequestID,
+				ResultCode:        resp.ResultCode,
+				ResultDesc:        resp.ResultDesc,
+			}, nil
+		case err != nil && !stkQueryPending(ctx, err):
+			return nil, err
+		}
+
+		delay = min(2*delay, maxDelay)
+		timer.Reset(delay)
+	}
+}
+
+// stkQueryPending reports whether an STKPushQuery error means the result is
+// not known yet rather than a permanent failure. Network errors, including
+// the HTTP client timing out a single attempt, are pending unless ctx itself
+// is done.
+func stkQueryPending(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	return errors.Is(err, types.ErrTransactionProcessing) ||
+		errors.Is(err, types.ErrRateLimited) ||
+		errors.Is(err, types.ErrServiceUnavailable)
+}
@@ -0,0 +1,147 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// stkServer creates a test server that accepts STK Pushes and answers queries
+// with "being processed" until processing queries have been made.
+func stkServer(processing int32, resultCode string, queries *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/mpesa/stkpush/v1/processrequest":
+			json.NewEncoder(w).Encode(types.STKPushResponse{
+				MerchantRequestID: "29115-34620561-1",
+				CheckoutRequestID: "ws_CO_191220191020363925",
+				ResponseCode:      "0",
+			})
+		case "/mpesa/stkpushquery/v1/query":
+			if atomic.AddInt32(queries, 1) <= processing {
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode(map[string]string{"errorCode": "500.001.1001", "errorMessage": "The transaction is being processed"})
+				return
+			}
+			json.NewEncoder(w).Encode(types.STKPushQueryResponse{
+				MerchantRequestID: "29115-34620561-1",
+				CheckoutRequestID: "ws_CO_191220191020363925",
+				ResultCode:        resultCode,
+				ResultDesc:        types.ResultCodeDescription(resultCode),
+			})
+		}
+	}))
+}
+
+// fastPolling returns options that poll every few milliseconds.
+func fastPolling(callbacks *client.STKCallbacks) *client.PayAndWaitOptions {
+	return &client.PayAndWaitOptions{
+		Callbacks:        callbacks,
+		InitialPollDelay: time.Millisecond,
+		MaxPollDelay:     5 * time.Millisecond,
+	}
+}
+
+// TestPayAndWait_Polling tests that polling skips "being processed" answers and classifies the result.
+func TestPayAndWait_Polling(t *testing.T) {
+	var queries int32
+	server := stkServer(2, types.ResultCodeCancelledByUser, &queries)
+	defer server.Close()
+
+	mpesa := client.NewMpesa(client.WithBaseURL(server.URL))
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+
+	outcome, err := mpesa.PayAndWait(context.Background(), payload, fastPolling(nil))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outcome.Status != types.STKCancelled || outcome.CheckoutRequestID != "ws_CO_191220191020363925" {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+	if got := atomic.LoadInt32(&queries); got != 3 {
+		t.Errorf("expected 3 queries, got %d", got)
+	}
+}
+
+// TestPayAndWait_SlowQuery tests that a query timed out by the HTTP client is polled again.
+func TestPayAndWait_SlowQuery(t *testing.T) {
+	var queries int32
+	server := stkServer(0, types.ResultCodeSuccess, &queries)
+	defer server.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/mpesa/stkpushquery/v1/query" && atomic.LoadInt32(&queries) == 0 {
+			atomic.AddInt32(&queries, 1)
+			time.Sleep(200 * time.Millisecond)
+		}
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer slow.Close()
+
+	mpesa := client.NewMpesa(client.WithBaseURL(slow.URL), client.WithTimeout(50*time.Millisecond))
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+
+	outcome, err := mpesa.PayAndWait(context.Background(), payload, fastPolling(nil))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outcome.Status != types.STKSucceeded {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+}
+
+// TestPayAndWait_Callback tests that a callback wins over polling.
+func TestPayAndWait_Callback(t *testing.T) {
+	var queries int32
+	server := stkServer(1000, "", &queries)
+	defer server.Close()
+
+	mpesa := client.NewMpesa(client.WithBaseURL(server.URL))
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+
+	callbacks := client.NewSTKCallbacks()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		callbacks.Deliver(context.Background(), &types.STKCallback{
+			CheckoutRequestID:  "ws_CO_191220191020363925",
+			ResultCode:         "0",
+			MpesaReceiptNumber: "NLJ7RT61SV",
+		})
+	}()
+
+	outcome, err := mpesa.PayAndWait(context.Background(), payload, fastPolling(callbacks))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outcome.Status != types.STKSucceeded || outcome.Callback == nil || outcome.Callback.MpesaReceiptNumber != "NLJ7RT61SV" {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+}
+
+// TestPayAndWait_ContextCancelled tests that PayAndWait stops when the context is done.
+func TestPayAndWait_ContextCancelled(t *testing.T) {
+	var queries int32
+	server := stkServer(1000, "", &queries)
+	defer server.Close()
+
+	mpesa := client.NewMpesa(client.WithBaseURL(server.URL))
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := mpesa.PayAndWait(ctx, payload, fastPolling(nil)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strconv"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// DefaultPullWindow is the longest date range covered by a single Pull API
+// query when PullQuery.Window is zero.
+const DefaultPullWindow = 24 * time.Hour
+
+// pullDateLayout is the Pull API date format, in Nairobi time.
+const pullDateLayout = "2006-01-02 15:04:05"
+
+// PullCheckpoint is the position of a PullAllTransactions walk. Persist it
+// and pass it back as PullQuery.Resume to continue where a run stopped.
+type PullCheckpoint struct {
+	// WindowStart is the start of the window being walked.
+	WindowStart time.Time `json:"windowStart"`
+	// Offset is the OffSetValue of the next transaction in that window.
+	Offset int `json:"offset"`
+}
+
+// PullQuery describes the transactions walked by PullAllTransactions.
+type PullQuery struct {
+	AccessToken string
+	ShortCode   string
+	// Start is the inclusive start of the range, End its exclusive end; a
+	// zero End means now. Both are truncated to the second.
+	Start, End time.Time
+	// Window is the longest range requested per query; zero means DefaultPullWindow.
+	Window time.Duration
+	// Resume, if set, continues a previous walk from its checkpoint instead of Start.
+	Resume *PullCheckpoint
+	// OnCheckpoint, if set, is called after every page, when the walk stops
+	// early and when it ends, with the position following the last
+	// transaction yielded.
+	OnCheckpoint func(PullCheckpoint)
+}
+
+// PullAllTransactions walks every transaction of a shortcode in a date range.
+// The range is split into windows of at most query.Window, each window is
+// paged through by OffSetValue until an empty page, and transactions already
+// yielded are skipped by TransactionID. A failed query yields its error and
+// ends the walk; the last checkpoint reported to OnCheckpoint resumes it.
+func (m *Mpesa) PullAllTransactions(ctx context.Context, query PullQuery) iter.Seq2[types.Transaction, error] {
+	return func(yield func(types.Transaction, error) bool) {
+		window := query.Window
+		if window <= 0 {
+			window = DefaultPullWindow
+		}
+		window = window.Truncate(time.Second)
+		if window <= 0 {
+			yield(types.Transaction{}, errors.New("invalid query: window shorter than a second"))
+			return
+		}
+		end := query.End
+		if end.IsZero() {
+			end = time.Now()
+		}
+		end = end.Truncate(time.Second)
+		start, offset := query.Start, 0
+		if query.Resume != nil {
+			start, offset = query.Resume.WindowStart, query.Resume.Offset
+		}
+		if start.IsZero() {
+			yield(types.Transaction{}, errors.New("invalid query: missing start time"))
+			return
+		}
+		start = start.Truncate(time.Second)
+
+		checkpoint := func() {
+			if query.OnCheckpoint != nil {
+				query.OnCheckpoint(PullCheckpoint{WindowStart: start, Offset: offset})
+			}
+		}
+		seen := make(map[string]struct{})
+		for start.Before(end) {
+			windowEnd := start.Add(window)
+			if windowEnd.After(end) {
+				windowEnd = end
+			}
+			for {
+				page, err := m.PullTransactions(ctx, types.PullTransactionsRequest{
+					AccessToken: query.AccessToken,
+					ShortCode:   query.ShortCode,
+					StartDate:   start.In(utils.Nairobi).Format(pullDateLayout),
+					EndDate:     windowEnd.Add(-time.Second).In(utils.Nairobi).Format(pullDateLayout),
+					OffSetValue: strconv.Itoa(offset),
+				})
+				if err != nil {
+					yield(types.Transaction{}, err)
+					return
+				}
+				if len(page.Transactions) == 0 {
+					break
+				}
+				for _, tx := range page.Transactions {
+					offset++
+					if _, ok := seen[tx.TransactionID]; ok {
+						continue
+					}
+					seen[tx.TransactionID] = struct{}{}
+					if !yield(tx, nil) {
+						checkpoint()
+						return
+					}
+				}
+				checkpoint()
+			}
+			start, offset = windowEnd, 0
+		}
+		checkpoint()
+	}
+}
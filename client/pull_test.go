@@ -0,0 +1,177 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// pullServer creates a test server that pages through transactions two at a
+// time, recording the windows queried.
+func pullServer(t *testing.T, transactions map[string]time.Time, order []string, windows *[]string) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		start, _ := time.ParseInLocation("2006-01-02 15:04:05", body["StartDate"], utils.Nairobi)
+		end, _ := time.ParseInLocation("2006-01-02 15:04:05", body["EndDate"], utils.Nairobi)
+		offset, _ := strconv.Atoi(body["OffSetValue"])
+
+		mu.Lock()
+		if offset == 0 {
+			*windows = append(*windows, body["StartDate"]+" - "+body["EndDate"])
+		}
+		mu.Unlock()
+
+		var matched []types.Transaction
+		for _, id := range order {
+			at := transactions[id]
+			if !at.Before(start) && !at.After(end) {
+				matched = append(matched, types.Transaction{TransactionID: id, TrxDate: at})
+			}
+		}
+		page := []types.Transaction{}
+		for i := offset; i < len(matched) && len(page) < 2; i++ {
+			page = append(page, matched[i])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.PullTransactionsResponse{ResponseCode: "1000", Transactions: page})
+	}))
+}
+
+// TestPullAllTransactions tests walking a multi-day range window by window and page by page.
+func TestPullAllTransactions(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, utils.Nairobi)
+	transactions := map[string]time.Time{
+		"TX1": day.Add(time.Hour),
+		"TX2": day.Add(2 * time.Hour),
+		"TX3": day.Add(3 * time.Hour),
+		"TX4": day.Add(26 * time.Hour),
+		"TX5": day.Add(50 * time.Hour),
+	}
+	// TX2 is listed twice, as happens when offsets shift under new payments.
+	order := []string{"TX1", "TX2", "TX2", "TX3", "TX4", "TX5"}
+	var windows []string
+	server := pullServer(t, transactions, order, &windows)
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	var ids []string
+	var last client.PullCheckpoint
+	query := client.PullQuery{
+		AccessToken:  "test-token",
+		ShortCode:    "600000",
+		Start:        day,
+		End:          day.AddDate(0, 0, 3),
+		OnCheckpoint: func(c client.PullCheckpoint) { last = c },
+	}
+	for tx, err := range mpesa.PullAllTransactions(context.Background(), query) {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		ids = append(ids, tx.TransactionID)
+	}
+	if len(ids) != 5 || ids[1] != "TX2" || ids[2] != "TX3" || ids[4] != "TX5" {
+		t.Errorf("unexpected transactions %v", ids)
+	}
+	want := []string{
+		"2024-03-01 00:00:00 - 2024-03-01 23:59:59",
+		"2024-03-02 00:00:00 - 2024-03-02 23:59:59",
+		"2024-03-03 00:00:00 - 2024-03-03 23:59:59",
+	}
+	if len(windows) != len(want) || windows[0] != want[0] || windows[2] != want[2] {
+		t.Errorf("expected windows %v, got %v", want, windows)
+	}
+	if !last.WindowStart.Equal(query.End) || last.Offset != 0 {
+		t.Errorf("expected the final checkpoint at the end of the range, got %+v", last)
+	}
+}
+
+// TestPullAllTransactions_Resume tests that a walk stopped early resumes after the last transaction yielded.
+func TestPullAllTransactions_Resume(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, utils.Nairobi)
+	transactions := map[string]time.Time{
+		"TX1": day.Add(time.Hour),
+		"TX2": day.Add(2 * time.Hour),
+		"TX3": day.Add(3 * time.Hour),
+		"TX4": day.Add(26 * time.Hour),
+	}
+	var windows []string
+	server := pullServer(t, transactions, []string{"TX1", "TX2", "TX3", "TX4"}, &windows)
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	var checkpoint client.PullCheckpoint
+	query := client.PullQuery{
+		AccessToken:  "test-token",
+		ShortCode:    "600000",
+		Start:        day,
+		End:          day.AddDate(0, 0, 2),
+		OnCheckpoint: func(c client.PullCheckpoint) { checkpoint = c },
+	}
+	for tx, err := range mpesa.PullAllTransactions(context.Background(), query) {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if tx.TransactionID == "TX3" {
+			break
+		}
+	}
+	if !checkpoint.WindowStart.Equal(day) || checkpoint.Offset != 3 {
+		t.Fatalf("unexpected checkpoint %+v", checkpoint)
+	}
+
+	query.Resume = &checkpoint
+	var ids []string
+	for tx, err := range mpesa.PullAllTransactions(context.Background(), query) {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		ids = append(ids, tx.TransactionID)
+	}
+	if len(ids) != 1 || ids[0] != "TX4" {
+		t.Errorf("expected only TX4 after resuming, got %v", ids)
+	}
+}
+
+// TestPullAllTransactions_Error tests that a failed query ends the walk with its error.
+func TestPullAllTransactions_Error(t *testing.T) {
+	server := mockServer(t, http.StatusBadRequest, map[string]string{
+		"errorCode":    "400.002.02",
+		"errorMessage": "Bad Request - Invalid ShortCode",
+	})
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	var errs int
+	for _, err := range mpesa.PullAllTransactions(context.Background(), client.PullQuery{
+		AccessToken: "test-token",
+		ShortCode:   "600000",
+		Start:       time.Now().Add(-time.Hour),
+	}) {
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("expected one error, got %d", errs)
+	}
+}
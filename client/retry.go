@@ -0,0 +1,155 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// RetryPolicy configures automatic retries of requests that failed with a
+// network error, 429 Too Many Requests or 503 Service Unavailable.
+//
+// Calls that do not move money, such as queries, URL registrations and
+// GenerateQRCode, are retried automatically. So is B2CPayment: Daraja
+// deduplicates v3 B2C payments on their OriginatorConversationID, so a
+// repeated request cannot pay twice. Every other call that moves money,
+// including STK pushes, v1 B2C, B2B and tax payments, reversals and C2B
+// simulations, carries nothing Daraja deduplicates on and is never retried;
+// a failure there leaves the outcome unknown until it is reconciled.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the second attempt; it doubles on
+	// every further attempt.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between attempts. A Retry-After header sent
+	// by Daraja takes precedence over the computed backoff but is capped at
+	// MaxDelay too, so a bad header cannot stall a retry.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy returns a policy of 3 attempts with backoff from 500ms up to 5s.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    5 * time.Second,
+	}
+}
+
+// SetRetryPolicy sets the retry policy. A nil policy disables retries.
+func (m *Mpesa) SetRetryPolicy(policy *RetryPolicy) {
+	m.retry = policy
+}
+
+// callKind tells the retry logic whether a call is safe to repeat.
+type callKind int
+
+const (
+	// readCall does not move money and can always be retried.
+	readCall callKind = iota
+	// moneyCall moves money and is never retried.
+	moneyCall
+	// dedupedCall moves money under an ID Daraja deduplicates on, so
+	// repeating it cannot pay twice.
+	dedupedCall
+)
+
+// idempotencyKeyCtx is the context key for the idempotency key.
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey returns a context carrying the key of a logical payment.
+// B2CPayment sends it as the OriginatorConversationID when the request leaves
+// that empty, so that Daraja deduplicates retries of the payment on it. Other
+// calls ignore the key.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// IdempotencyKey returns the idempotency key carried by ctx, if any.
+func IdempotencyKey(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key, ok && key != ""
+}
+
+// maxAttempts returns how many attempts a call of the given kind may make.
+func (p *RetryPolicy) maxAttempts(kind callKind) int {
+	if p == nil || p.MaxAttempts < 2 || kind == moneyCall {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// backoff returns the delay before the attempt following attempt.
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxDelay > 0 {
+				delay = min(delay, p.MaxDelay)
+			}
+			return delay
+		}
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	if p.MaxDelay > 0 && (delay > p.MaxDelay || delay <= 0) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Equal jitter: keep half the delay, randomize the other half.
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
+
+// retryable reports whether a failed attempt should be retried.
+func retryable(ctx context.Context, resp *http.Response, err error) bool {
+	if err != nil {
+		var apiErr *types.APIError
+		return ctx.Err() == nil && !errors.Is(err, ErrNoCredentials) && !errors.As(err, &apiErr)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
+// send performs a request, retrying it according to the retry policy.
+func (m *Mpesa) send(ctx context.Context, method, url, accessToken string, payload interface{}, kind callKind) (*http.Response, error) {
+	attempts := m.retry.maxAttempts(kind)
+	for attempt := 1; ; attempt++ {
+		resp, err := m.sendOnce(ctx, method, url, accessToken, payload)
+		if attempt >= attempts || !retryable(ctx, resp, err) {
+			return resp, err
+		}
+
+		delay := m.retry.backoff(attempt, resp)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
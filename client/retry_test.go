@@ -0,0 +1,183 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// flakyServer creates a test server that answers 503 to the first failures requests.
+func flakyServer(failures int32, calls *int32, response interface{}) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// retryingClient returns a client with a fast retry policy pointed at url.
+func retryingClient(url string) *client.Mpesa {
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(url)
+	mpesa.SetRetryPolicy(&client.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	return mpesa
+}
+
+// b2cPayload returns a valid B2C payload.
+func b2cPayload() types.B2CSendRequest {
+	return types.B2CSendRequest{
+		AccessToken:        "test-token",
+		InitiatorName:      "test-initiator",
+		SecurityCredential: "credential",
+		CommandID:          "BusinessPayment",
+		Amount:             100 * types.Shilling,
+		PartyA:             "123456",
+		PartyB:             "254700000000",
+		Remarks:            "Test B2C",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+		Occasion:           "Test",
+	}
+}
+
+// TestRetry_ReadCall tests that read-style calls are retried automatically.
+func TestRetry_ReadCall(t *testing.T) {
+	var calls int32
+	server := flakyServer(2, &calls, types.STKPushQueryResponse{ResultCode: "0"})
+	defer server.Close()
+
+	payload := types.STKPushQueryRequest{
+		AccessToken:       "test-token",
+		BusinessShortCode: "174379",
+		Password:          "encoded_password",
+		Timestamp:         "20240102030405",
+		CheckoutRequestID: "ws_CO_191220191020363925",
+	}
+	if _, err := retryingClient(server.URL).STKPushQuery(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+// TestRetry_MoneyCallWithoutKey tests that money-moving calls are not retried by default.
+func TestRetry_MoneyCallWithoutKey(t *testing.T) {
+	var calls int32
+	server := flakyServer(1, &calls, types.B2CSendResponse{ResponseCode: "0"})
+	defer server.Close()
+
+	if _, err := retryingClient(server.URL).B2CSend(context.Background(), b2cPayload()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected 1 attempt, got %d", got)
+	}
+}
+
+// TestRetry_MoneyCallWithKey tests that an idempotency key does not make v1 money calls retryable.
+func TestRetry_MoneyCallWithKey(t *testing.T) {
+	var calls int32
+	server := flakyServer(1, &calls, types.B2CSendResponse{ResponseCode: "0"})
+	defer server.Close()
+
+	ctx := client.WithIdempotencyKey(context.Background(), "payout-42")
+	if _, err := retryingClient(server.URL).B2CSend(ctx, b2cPayload()); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected 1 attempt, got %d", got)
+	}
+}
+
+// TestRetry_B2CPayment tests that v3 B2C payments are retried under the idempotency key as OriginatorConversationID.
+func TestRetry_B2CPayment(t *testing.T) {
+	var calls int32
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		ids = append(ids, body["OriginatorConversationID"].(string))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(types.B2CSendResponse{ResponseCode: "0"})
+	}))
+	defer server.Close()
+
+	ctx := client.WithIdempotencyKey(context.Background(), "payout-42")
+	if _, err := retryingClient(server.URL).B2CPayment(ctx, b2cPayload().V3("")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(ids) != 2 || ids[0] != "payout-42" || ids[1] != "payout-42" {
+		t.Errorf("expected 2 attempts under payout-42, got %v", ids)
+	}
+}
+
+// TestRetry_GivesUp tests that the last failure is returned after MaxAttempts.
+func TestRetry_GivesUp(t *testing.T) {
+	var calls int32
+	server := flakyServer(10, &calls, types.GetBalanceResponse{})
+	defer server.Close()
+
+	payload := types.GetBalanceRequest{
+		AccessToken:        "test-token",
+		Initiator:          "test-initiator",
+		SecurityCredential: "credential",
+		PartyA:             "123456",
+		IdentifierType:     "4",
+		Remarks:            "Test balance",
+		QueueTimeOutURL:    "https://timeout.example.com",
+		ResultURL:          "https://result.example.com",
+	}
+	_, err := retryingClient(server.URL).GetBalance(context.Background(), payload)
+	if !errors.Is(err, types.ErrServiceUnavailable) {
+		t.Errorf("expected ErrServiceUnavailable, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+// TestRetry_RetryAfterCapped tests that a Retry-After header is capped at MaxDelay.
+func TestRetry_RetryAfterCapped(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(types.STKPushQueryResponse{ResultCode: "0"})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	payload := types.STKPushQueryRequest{
+		AccessToken:       "test-token",
+		BusinessShortCode: "174379",
+		Password:          "encoded_password",
+		Timestamp:         "20240102030405",
+		CheckoutRequestID: "ws_CO_191220191020363925",
+	}
+	if _, err := retryingClient(server.URL).STKPushQuery(ctx, payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// stkSigner holds Lipa Na M-Pesa passkeys and signs STK requests with them.
+type stkSigner struct {
+	mu               sync.RWMutex
+	passkeys         map[string]string
+	defaultShortCode string
+}
+
+// SetPasskey configures the Lipa Na M-Pesa passkey for a business shortcode.
+// STK Push and STK Push Query requests for that shortcode that carry no
+// Password are signed with it, using a timestamp generated together with the
+// password. The most recently configured shortcode is used when a request
+// leaves BusinessShortCode empty.
+func (m *Mpesa) SetPasskey(shortCode, passkey string) {
+	m.stk.mu.Lock()
+	defer m.stk.mu.Unlock()
+	if m.stk.passkeys == nil {
+		m.stk.passkeys = make(map[string]string)
+	}
+	m.stk.passkeys[shortCode] = passkey
+	m.stk.defaultShortCode = shortCode
+}
+
+// sign resolves the shortcode, password and timestamp for an STK request.
+// A caller-supplied password/timestamp pair is used as is; otherwise both are
+// derived from the configured passkey at the same instant.
+func (s *stkSigner) sign(shortCode, password, timestamp string) (string, string, string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if shortCode == "" {
+		shortCode = s.defaultShortCode
+	}
+	if shortCode == "" {
+		return "", "", "", errors.New("invalid payload: BusinessShortCode is required")
+	}
+	if password != "" {
+		return shortCode, password, timestamp, nil
+	}
+	passkey, ok := s.passkeys[shortCode]
+	if !ok {
+		return "", "", "", errors.New("invalid payload: Password and Timestamp are required when no passkey is configured for shortcode " + shortCode)
+	}
+	password, timestamp = utils.STKPassword(shortCode, passkey, time.Now())
+	return shortCode, password, timestamp, nil
+}
@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// echoServer creates a test server that hands every decoded request body to check.
+func echoServer(t *testing.T, response interface{}, check func(body map[string]interface{})) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		check(body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}))
+}
+
+// TestSTKPush_ConfiguredPasskey tests that the password and timestamp are derived together.
+func TestSTKPush_ConfiguredPasskey(t *testing.T) {
+	server := echoServer(t, types.STKPushResponse{ResponseCode: "0"}, func(body map[string]interface{}) {
+		timestamp, _ := body["Timestamp"].(string)
+		if _, err := utils.ParseTimestamp(timestamp); err != nil {
+			t.Errorf("invalid timestamp %q: %v", timestamp, err)
+		}
+		if want := utils.EncodePasswordWithTimestamp("174379", "passkey", timestamp); body["Password"] != want {
+			t.Errorf("expected password %s, got %v", want, body["Password"])
+		}
+		if body["BusinessShortCode"] != "174379" {
+			t.Errorf("expected shortcode %s, got %v", "174379", body["BusinessShortCode"])
+		}
+	})
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+	mpesa.SetPasskey("174379", "passkey")
+
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+	payload.BusinessShortCode = ""
+	payload.Password = ""
+	payload.Timestamp = ""
+	if _, err := mpesa.STKPush(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestSTKPushQuery_CallerTimestamp tests that a caller-supplied timestamp is sent unchanged.
+func TestSTKPushQuery_CallerTimestamp(t *testing.T) {
+	server := echoServer(t, types.STKPushQueryResponse{ResultCode: "0"}, func(body map[string]interface{}) {
+		if body["Timestamp"] != "20240102030405" {
+			t.Errorf("expected timestamp %s, got %v", "20240102030405", body["Timestamp"])
+		}
+	})
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+
+	payload := types.STKPushQueryRequest{
+		AccessToken:       "test-token",
+		BusinessShortCode: "174379",
+		Password:          utils.EncodePasswordWithTimestamp("174379", "passkey", "20240102030405"),
+		Timestamp:         "20240102030405",
+		CheckoutRequestID: "ws_CO_191220191020363925",
+	}
+	if _, err := mpesa.STKPushQuery(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+// TestSTKPush_PasswordWithoutTimestamp tests that a password without its timestamp is rejected.
+func TestSTKPush_PasswordWithoutTimestamp(t *testing.T) {
+	mpesa := client.NewMpesa()
+	payload := stkPayload()
+	payload.AccessToken = "test-token"
+	payload.Timestamp = ""
+	if _, err := mpesa.STKPush(context.Background(), payload); err == nil {
+		t.Fatal("expected validation error, got nil")
+	}
+}
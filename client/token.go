@@ -0,0 +1,158 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// tokenRefreshMargin is how long before expiry a cached token is refreshed.
+const tokenRefreshMargin = 60 * time.Second
+
+// tokenRefreshTimeout bounds a token refresh. The refresh outlives the caller
+// that started it, so it cannot rely on the caller's context or on the HTTP
+// client having a timeout.
+var tokenRefreshTimeout = DefaultTimeout
+
+// ErrNoCredentials is returned when a request carries no AccessToken and the
+// client has no consumer key and secret to obtain one.
+var ErrNoCredentials = errors.New("no access token provided and no consumer credentials configured")
+
+// tokenCache caches the OAuth access token and collapses concurrent refreshes
+// into a single call to the token endpoint.
+type tokenCache struct {
+	mu             sync.Mutex
+	consumerKey    string
+	consumerSecret string
+	token          string
+	refreshAt      time.Time
+	call           *tokenCall
+}
+
+// tokenCall is an in-flight token refresh shared by all waiting callers.
+type tokenCall struct {
+	done  chan struct{}
+	token string
+	err   error
+}
+
+// setCredentials replaces the consumer credentials and drops any cached token.
+func (c *tokenCache) setCredentials(consumerKey, consumerSecret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.consumerKey = consumerKey
+	c.consumerSecret = consumerSecret
+	c.token = ""
+	c.refreshAt = time.Time{}
+}
+
+// invalidate drops the cached token if it is still the given one.
+func (c *tokenCache) invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+		c.refreshAt = time.Time{}
+	}
+}
+
+// get returns the cached token, refreshing it through m when it is missing or
+// about to expire. Only one refresh runs at a time; other callers wait for it.
+func (c *tokenCache) get(ctx context.Context, m *Mpesa) (string, error) {
+	c.mu.Lock()
+	if c.consumerKey == "" || c.consumerSecret == "" {
+		c.mu.Unlock()
+		return "", ErrNoCredentials
+	}
+	if c.token != "" && time.Now().Before(c.refreshAt) {
+		token := c.token
+		c.mu.Unlock()
+		return token, nil
+	}
+	call := c.call
+	if call == nil {
+		call = &tokenCall{done: make(chan struct{})}
+		c.call = call
+		go c.refresh(context.WithoutCancel(ctx), m, call, c.consumerKey, c.consumerSecret)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.token, call.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// refresh fetches a new token and publishes it to everyone waiting on call.
+func (c *tokenCache) refresh(ctx context.Context, m *Mpesa, call *tokenCall, consumerKey, consumerSecret string) {
+	ctx, cancel := context.WithTimeout(ctx, tokenRefreshTimeout)
+	defer cancel()
+	resp, err := m.GetAccessToken(ctx, consumerKey, consumerSecret)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.call = nil
+	if err == nil {
+		var lifetime time.Duration
+		lifetime, err = resp.Lifetime()
+		if err == nil {
+			margin := tokenRefreshMargin
+			if lifetime < 2*margin {
+				margin = lifetime / 2
+			}
+			// Only cache the token if the credentials were not swapped mid-flight.
+			if c.consumerKey == consumerKey && c.consumerSecret == consumerSecret {
+				c.token = resp.AccessToken
+				c.refreshAt = time.Now().Add(lifetime - margin)
+			}
+			call.token = resp.AccessToken
+		}
+	}
+	call.err = err
+	close(call.done)
+}
+
+// SetCredentials configures the consumer key and secret used to obtain access
+// tokens automatically for requests that do not carry their own AccessToken.
+func (m *Mpesa) SetCredentials(consumerKey, consumerSecret string) {
+	m.tokens.setCredentials(consumerKey, consumerSecret)
+}
+
+// Token returns a valid access token, fetching or refreshing it as needed.
+func (m *Mpesa) Token(ctx context.Context) (string, error) {
+	return m.tokens.get(ctx, m)
+}
+
+// resolveToken returns accessToken if set, otherwise the managed token.
+func (m *Mpesa) resolveToken(ctx context.Context, accessToken string) (string, error) {
+	if accessToken != "" {
+		return accessToken, nil
+	}
+	return m.Token(ctx)
+}
+
+// sendOnce authorizes and performs a request. When the token is managed by the
+// client and Daraja answers 401, the token is refreshed and the request is
+// retried once.
+func (m *Mpesa) sendOnce(ctx context.Context, method, url, accessToken string, payload interface{}) (*http.Response, error) {
+	token, err := m.resolveToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.doRequest(ctx, method, url, token, payload)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || accessToken != "" {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	m.tokens.invalidate(token)
+	if token, err = m.Token(ctx); err != nil {
+		return nil, err
+	}
+	return m.doRequest(ctx, method, url, token, payload)
+}
@@ -0,0 +1,138 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// tokenServer creates a test server that issues tokens and accepts STK Push
+// requests carrying a valid token.
+func tokenServer(t *testing.T, tokenCalls *int32, valid func(token string) bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/oauth/v1/generate" {
+			n := atomic.AddInt32(tokenCalls, 1)
+			time.Sleep(20 * time.Millisecond)
+			json.NewEncoder(w).Encode(types.AccessTokenResponse{
+				AccessToken: "token-" + string(rune('0'+n)),
+				ExpiresIn:   "3599",
+			})
+			return
+		}
+		token := r.Header.Get("Authorization")[len("Bearer "):]
+		if !valid(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(types.STKPushResponse{ResponseCode: "0"})
+	}))
+}
+
+// stkPayload returns a valid STK Push payload without an access token.
+func stkPayload() types.STKPushRequest {
+	return types.STKPushRequest{
+		BusinessShortCode: "123456",
+		Password:          "encoded_password",
+		Timestamp:         "20191219102115",
+		Amount:            100 * types.Shilling,
+		PartyA:            "254700000000",
+		PartyB:            "123456",
+		PhoneNumber:       "254700000000",
+		CallBackURL:       "https://callback.example.com",
+		AccountReference:  "Test123",
+		TransactionDesc:   "Payment",
+	}
+}
+
+// TestToken_SingleFlight tests that concurrent requests share one token fetch.
+func TestToken_SingleFlight(t *testing.T) {
+	ctx := context.Background()
+	var tokenCalls int32
+	server := tokenServer(t, &tokenCalls, func(string) bool { return true })
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+	mpesa.SetCredentials("consumer_key", "consumer_secret")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := mpesa.STKPush(ctx, stkPayload()); err != nil {
+				t.Errorf("concurrent STKPush failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := mpesa.STKPush(ctx, stkPayload()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&tokenCalls); got != 1 {
+		t.Errorf("expected 1 token request, got %d", got)
+	}
+}
+
+// TestToken_RetryOnUnauthorized tests that a 401 refreshes the token and retries once.
+func TestToken_RetryOnUnauthorized(t *testing.T) {
+	ctx := context.Background()
+	var tokenCalls int32
+	server := tokenServer(t, &tokenCalls, func(token string) bool { return token == "token-2" })
+	defer server.Close()
+
+	mpesa := client.NewMpesa()
+	mpesa.SetBaseURL(server.URL)
+	mpesa.SetCredentials("consumer_key", "consumer_secret")
+
+	if _, err := mpesa.STKPush(ctx, stkPayload()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&tokenCalls); got != 2 {
+		t.Errorf("expected 2 token requests, got %d", got)
+	}
+}
+
+// TestToken_NoCredentials tests that a missing token and missing credentials is reported.
+func TestToken_NoCredentials(t *testing.T) {
+	mpesa := client.NewMpesa()
+	_, err := mpesa.STKPush(context.Background(), stkPayload())
+	if !errors.Is(err, client.ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials, got %v", err)
+	}
+}
+
+// TestToken_RefreshTimeout tests that a hung token request does not block later refreshes.
+func TestToken_RefreshTimeout(t *testing.T) {
+	client.SetTokenRefreshTimeout(t, 50*time.Millisecond)
+	var tokenCalls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&tokenCalls, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		json.NewEncoder(w).Encode(types.AccessTokenResponse{AccessToken: "token", ExpiresIn: "3599"})
+	}))
+	defer server.Close()
+
+	mpesa := client.NewMpesa(client.WithBaseURL(server.URL), client.WithHTTPClient(&http.Client{}), client.WithCredentials("consumer_key", "consumer_secret"))
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := mpesa.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the hung refresh to time out, got %v", err)
+	}
+	if token, err := mpesa.Token(ctx); err != nil || token != "token" {
+		t.Errorf("expected a fresh token, got %q, %v", token, err)
+	}
+}
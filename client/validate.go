@@ -0,0 +1,114 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/freelancer254/mpesa-go/phone"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// RegisterValidations registers the validation tags used by the request
+// types on validate. NewMpesa and WithValidator call it; call it yourself
+// only to validate requests with a validator the client does not own.
+//
+//	amount=min-max  a types.Amount of whole shillings within [min, max];
+//	                amount=min sets no upper limit
+//	msisdn          a mobile number in 2547XXXXXXXX or 2541XXXXXXXX form
+//	prn             a KRA payment registration number of 10 to 20 digits
+func RegisterValidations(validate *validator.Validate) error {
+	if err := validate.RegisterValidation("amount", validateAmount); err != nil {
+		return err
+	}
+	if err := validate.RegisterValidation("msisdn", validateMSISDN); err != nil {
+		return err
+	}
+	return validate.RegisterValidation("prn", validatePRN)
+}
+
+// validateAmount implements the amount tag.
+func validateAmount(fl validator.FieldLevel) bool {
+	field := fl.Field()
+	if field.Kind() != reflect.Int64 {
+		return false
+	}
+	amount := types.Amount(field.Int())
+	min, max, err := amountLimits(fl.Param())
+	if err != nil {
+		panic(err)
+	}
+	return amount.IsWhole() && amount >= min && (max == 0 || amount <= max)
+}
+
+// amountLimits parses the "min-max" or "min" parameter of the amount tag, in shillings.
+func amountLimits(param string) (min, max types.Amount, err error) {
+	low, high, bounded := strings.Cut(param, "-")
+	n, err := strconv.ParseInt(low, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid amount tag parameter %q", param)
+	}
+	min = types.Amount(n) * types.Shilling
+	if bounded {
+		n, err = strconv.ParseInt(high, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, fmt.Errorf("invalid amount tag parameter %q", param)
+		}
+		max = types.Amount(n) * types.Shilling
+	}
+	return min, max, nil
+}
+
+// validateMSISDN implements the msisdn tag.
+func validateMSISDN(fl validator.FieldLevel) bool {
+	return fl.Field().Kind() == reflect.String && phone.Valid(fl.Field().String())
+}
+
+// validatePRN implements the prn tag.
+func validatePRN(fl validator.FieldLevel) bool {
+	if fl.Field().Kind() != reflect.String {
+		return false
+	}
+	prn := fl.Field().String()
+	if len(prn) < 10 || len(prn) > 20 {
+		return false
+	}
+	for _, r := range prn {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalize rewrites the phone numbers of the request pointed to by payload,
+// the string fields tagged msisdn, into MSISDN form when phone normalization
+// is on. Numbers that cannot be normalized are left for validation to report.
+func (m *Mpesa) normalize(payload interface{}) {
+	if !m.normalizePhones {
+		return
+	}
+	v := reflect.ValueOf(payload).Elem()
+	t := v.Type()
+	for i := range t.NumField() {
+		field := v.Field(i)
+		if field.Kind() != reflect.String || !slices.Contains(strings.Split(t.Field(i).Tag.Get("validate"), ","), "msisdn") {
+			continue
+		}
+		if number, err := phone.Normalize(field.String()); err == nil {
+			field.SetString(number)
+		}
+	}
+}
+
+// newValidator returns a validator with the request validation tags registered.
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	// Registering the client's fixed tags cannot fail.
+	_ = RegisterValidations(validate)
+	return validate
+}
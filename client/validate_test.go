@@ -0,0 +1,117 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// stkRequest returns a valid STK Push request for amount.
+func stkRequest(amount types.Amount) types.STKPushRequest {
+	return types.STKPushRequest{
+		AccessToken:       "test-token",
+		BusinessShortCode: "123456",
+		Password:          "encoded_password",
+		Timestamp:         "20191219102115",
+		Amount:            amount,
+		PartyA:            "254700000000",
+		PartyB:            "123456",
+		PhoneNumber:       "254700000000",
+		CallBackURL:       "https://callback.example.com",
+		AccountReference:  "Test123",
+		TransactionDesc:   "Payment",
+	}
+}
+
+// TestAmountValidation tests that amounts outside an API's limits are rejected before sending.
+func TestAmountValidation(t *testing.T) {
+	var body map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(types.STKPushResponse{ResponseCode: "0"})
+	}))
+	defer server.Close()
+
+	for _, validate := range []*validator.Validate{nil, validator.New()} {
+		opts := []client.Option{client.WithBaseURL(server.URL)}
+		if validate != nil {
+			opts = append(opts, client.WithValidator(validate))
+		}
+		mpesa := client.NewMpesa(opts...)
+
+		for _, amount := range []types.Amount{0, 250001 * types.Shilling, 10050} {
+			if _, err := mpesa.STKPush(context.Background(), stkRequest(amount)); err == nil || !strings.Contains(err.Error(), "invalid payload") {
+				t.Errorf("expected amount %s to be rejected, got %v", amount, err)
+			}
+		}
+		if _, err := mpesa.STKPush(context.Background(), stkRequest(250000*types.Shilling)); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if string(body["Amount"]) != "250000" {
+			t.Errorf("expected the amount sent as a whole number, got %s", body["Amount"])
+		}
+	}
+}
+
+// TestAmount_JSON tests decoding amounts sent as numbers or strings.
+func TestAmount_JSON(t *testing.T) {
+	var amounts []types.Amount
+	if err := json.Unmarshal([]byte(`[1500, 1500.5, "1500.00", "", null]`), &amounts); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if amounts[0] != 1500*types.Shilling || amounts[1] != 150050 || amounts[2] != 1500*types.Shilling || amounts[3] != 0 {
+		t.Errorf("unexpected amounts %v", amounts)
+	}
+	if data, _ := json.Marshal([]types.Amount{150050, -4510 * types.Shilling}); string(data) != "[1500.50,-4510]" {
+		t.Errorf("unexpected encoding %s", data)
+	}
+	if err := json.Unmarshal([]byte(`"1.005"`), &amounts[0]); err == nil {
+		t.Error("expected an error for an inexact amount")
+	}
+	if total := types.Sum(amounts...).Sub(100 * types.Shilling); total != 440050 || !total.Add(50).IsWhole() {
+		t.Errorf("unexpected total %s", total)
+	}
+}
+
+// TestWithPhoneNormalization tests that phone numbers are normalized before validation when enabled.
+func TestWithPhoneNormalization(t *testing.T) {
+	var body map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		json.NewEncoder(w).Encode(types.B2CSendResponse{ResponseCode: "0"})
+	}))
+	defer server.Close()
+
+	payload := types.B2CSendRequest{
+		AccessToken:        "test-token",
+		InitiatorName:      "testapi",
+		SecurityCredential: "credential",
+		CommandID:          "BusinessPayment",
+		Amount:             100 * types.Shilling,
+		PartyA:             "600000",
+		PartyB:             "0712 345 678",
+		Remarks:            "Payout",
+		QueueTimeOutURL:    "https://example.com/timeout",
+		ResultURL:          "https://example.com/result",
+		Occasion:           "Test",
+	}
+	if _, err := client.NewMpesa(client.WithBaseURL(server.URL)).B2CSend(context.Background(), payload); err == nil || !strings.Contains(err.Error(), "msisdn") {
+		t.Errorf("expected an msisdn validation error, got %v", err)
+	}
+
+	mpesa := client.NewMpesa(client.WithBaseURL(server.URL), client.WithPhoneNormalization())
+	if _, err := mpesa.B2CSend(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if body["PartyB"] != "254712345678" {
+		t.Errorf("expected the normalized number to be sent, got %q", body["PartyB"])
+	}
+}
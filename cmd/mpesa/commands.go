@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// commands maps subcommand names to their implementation.
+var commands = map[string]command{
+	"token":        {"Fetch an OAuth access token", tokenCommand},
+	"stkpush":      {"Send an STK Push prompt to a customer", stkPushCommand},
+	"stkquery":     {"Query the status of an STK Push", stkQueryCommand},
+	"balance":      {"Request the account balance of the shortcode", balanceCommand},
+	"status":       {"Request the status of a transaction", statusCommand},
+	"reverse":      {"Reverse a transaction", reverseCommand},
+	"b2c":          {"Pay a customer from the shortcode", b2cCommand},
+	"b2b":          {"Pay another business from the shortcode", b2bCommand},
+	"register-url": {"Register C2B validation and confirmation URLs", registerURLCommand},
+	"pull":         {"Pull the transactions of the shortcode", pullCommand},
+}
+
+// asyncFlags are the flags shared by commands whose result is delivered to a ResultURL.
+type asyncFlags struct {
+	resultURL  *string
+	timeoutURL *string
+	remarks    *string
+}
+
+// defineAsyncFlags defines the ResultURL, QueueTimeOutURL and Remarks flags on fs.
+func defineAsyncFlags(fs *flag.FlagSet, remarks string) asyncFlags {
+	return asyncFlags{
+		resultURL:  fs.String("result-url", "", "URL receiving the result (default profile result_url)"),
+		timeoutURL: fs.String("timeout-url", "", "URL receiving queue timeouts (default profile timeout_url)"),
+		remarks:    fs.String("remarks", remarks, "remarks sent with the request"),
+	}
+}
+
+// urls returns the result and timeout URLs, falling back to the profile.
+func (f asyncFlags) urls(p *profile) (string, string, error) {
+	resultURL, timeoutURL := or(*f.resultURL, p.ResultURL), or(*f.timeoutURL, p.TimeoutURL)
+	if resultURL == "" {
+		return "", "", errors.New("no result URL: pass --result-url or set MPESA_RESULT_URL")
+	}
+	return resultURL, or(timeoutURL, resultURL), nil
+}
+
+// or returns value, or fallback when value is empty.
+func or(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
+
+// required returns an error naming the first empty flag of the given
+// name/value pairs.
+func required(pairs ...string) error {
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] == "" {
+			return errors.New("missing required flag --" + pairs[i])
+		}
+	}
+	return nil
+}
+
+// tokenCommand fetches an access token with the profile credentials.
+func tokenCommand(fs *flag.FlagSet) action {
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if a.profile.ConsumerKey == "" || a.profile.ConsumerSecret == "" {
+			return nil, client.ErrNoCredentials
+		}
+		return a.mpesa.GetAccessToken(ctx, a.profile.ConsumerKey, a.profile.ConsumerSecret)
+	}
+}
+
+// stkPushCommand sends an STK Push, optionally waiting for its outcome.
+func stkPushCommand(fs *flag.FlagSet) action {
+	phone := fs.String("phone", "", "customer phone number, e.g. 254712345678")
+	amount := fs.String("amount", "", "amount in whole shillings")
+	reference := fs.String("reference", "", "account reference shown to the customer")
+	desc := fs.String("desc", "Payment", "transaction description")
+	shortCode := fs.String("shortcode", "", "business shortcode (default profile shortcode)")
+	partyB := fs.String("party-b", "", "shortcode receiving the payment (default the business shortcode)")
+	callbackURL := fs.String("callback-url", "", "URL receiving the STK callback (default profile callback_url)")
+	wait := fs.Bool("wait", false, "poll until the customer completes or cancels the prompt")
+	poll := fs.Duration("poll", 5*time.Second, "initial delay between status queries with --wait")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		sc := or(*shortCode, a.profile.ShortCode)
+		callback := or(*callbackURL, a.profile.CallbackURL)
+		if err := required("phone", *phone, "amount", *amount, "reference", *reference, "shortcode", sc, "callback-url", callback); err != nil {
+			return nil, err
+		}
+		value, err := types.ParseAmount(*amount)
+		if err != nil {
+			return nil, err
+		}
+		payload := types.STKPushRequest{
+			BusinessShortCode: sc,
+			Amount:            value,
+			PartyA:            *phone,
+			PartyB:            or(*partyB, sc),
+			PhoneNumber:       *phone,
+			CallBackURL:       callback,
+			AccountReference:  *reference,
+			TransactionDesc:   *desc,
+		}
+		if *wait {
+			return a.mpesa.PayAndWait(ctx, payload, &client.PayAndWaitOptions{InitialPollDelay: *poll})
+		}
+		return a.mpesa.STKPush(ctx, payload)
+	}
+}
+
+// stkQueryCommand queries the status of an STK Push.
+func stkQueryCommand(fs *flag.FlagSet) action {
+	id := fs.String("id", "", "CheckoutRequestID returned by stkpush")
+	shortCode := fs.String("shortcode", "", "business shortcode (default profile shortcode)")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if err := required("id", *id); err != nil {
+			return nil, err
+		}
+		return a.mpesa.STKPushQuery(ctx, types.STKPushQueryRequest{
+			BusinessShortCode: or(*shortCode, a.profile.ShortCode),
+			CheckoutRequestID: *id,
+		})
+	}
+}
+
+// balanceCommand requests the account balance.
+func balanceCommand(fs *flag.FlagSet) action {
+	partyA := fs.String("shortcode", "", "shortcode to query (default profile shortcode)")
+	identifierType := fs.String("identifier-type", "4", "identifier type of the shortcode: 2 till, 4 paybill")
+	async := defineAsyncFlags(fs, "Balance query")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		initiator, credential, err := a.profile.initiator()
+		if err != nil {
+			return nil, err
+		}
+		resultURL, timeoutURL, err := async.urls(a.profile)
+		if err != nil {
+			return nil, err
+		}
+		return a.mpesa.GetBalance(ctx, types.GetBalanceRequest{
+			Initiator:          initiator,
+			SecurityCredential: credential,
+			PartyA:             or(*partyA, a.profile.ShortCode),
+			IdentifierType:     *identifierType,
+			Remarks:            *async.remarks,
+			QueueTimeOutURL:    timeoutURL,
+			ResultURL:          resultURL,
+		})
+	}
+}
+
+// statusCommand requests the status of a transaction.
+func statusCommand(fs *flag.FlagSet) action {
+	id := fs.String("id", "", "M-Pesa receipt of the transaction")
+	originatorID := fs.String("originator-id", "", "OriginatorConversationID of the request, instead of --id")
+	partyA := fs.String("shortcode", "", "shortcode the transaction belongs to (default profile shortcode)")
+	identifierType := fs.String("identifier-type", "4", "identifier type of the shortcode: 2 till, 4 paybill")
+	occasion := fs.String("occasion", "Support query", "occasion sent with the request")
+	async := defineAsyncFlags(fs, "Status query")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if *id == "" && *originatorID == "" {
+			return nil, errors.New("missing required flag --id or --originator-id")
+		}
+		initiator, credential, err := a.profile.initiator()
+		if err != nil {
+			return nil, err
+		}
+		resultURL, timeoutURL, err := async.urls(a.profile)
+		if err != nil {
+			return nil, err
+		}
+		return a.mpesa.QueryTransaction(ctx, types.QueryTransactionRequest{
+			Initiator:                initiator,
+			SecurityCredential:       credential,
+			TransactionID:            *id,
+			OriginatorConversationID: *originatorID,
+			PartyA:                   or(*partyA, a.profile.ShortCode),
+			IdentifierType:           *identifierType,
+			ResultURL:                resultURL,
+			QueueTimeOutURL:          timeoutURL,
+			Remarks:                  *async.remarks,
+			Occasion:                 *occasion,
+		})
+	}
+}
+
+// reverseCommand reverses a transaction.
+func reverseCommand(fs *flag.FlagSet) action {
+	id := fs.String("id", "", "M-Pesa receipt of the transaction to reverse")
+	amount := fs.String("amount", "", "amount of the transaction")
+	receiver := fs.String("receiver", "", "shortcode that received the payment (default profile shortcode)")
+	receiverType := fs.String("receiver-type", "11", "identifier type of the receiver")
+	occasion := fs.String("occasion", "Reversal", "occasion sent with the request")
+	async := defineAsyncFlags(fs, "Reversal")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if err := required("id", *id, "amount", *amount); err != nil {
+			return nil, err
+		}
+		value, err := types.ParseAmount(*amount)
+		if err != nil {
+			return nil, err
+		}
+		initiator, credential, err := a.profile.initiator()
+		if err != nil {
+			return nil, err
+		}
+		resultURL, timeoutURL, err := async.urls(a.profile)
+		if err != nil {
+			return nil, err
+		}
+		return a.mpesa.ReverseTransaction(ctx, types.ReverseTransactionRequest{
+			Initiator:              initiator,
+			SecurityCredential:     credential,
+			TransactionID:          *id,
+			Amount:                 value,
+			ReceiverParty:          or(*receiver, a.profile.ShortCode),
+			ReceiverIdentifierType: *receiverType,
+			ResultURL:              resultURL,
+			QueueTimeOutURL:        timeoutURL,
+			Remarks:                *async.remarks,
+			Occasion:               *occasion,
+		})
+	}
+}
+
+// b2cCommand pays a customer through the v3 B2C API.
+func b2cCommand(fs *flag.FlagSet) action {
+	id := fs.String("id", "", "OriginatorConversationID of the payment; reuse it to retry the same payment (default a random ID)")
+	phone := fs.String("phone", "", "customer phone number, e.g. 254712345678")
+	amount := fs.String("amount", "", "amount in whole shillings")
+	commandID := fs.String("command", "BusinessPayment", "SalaryPayment, BusinessPayment or PromotionPayment")
+	partyA := fs.String("shortcode", "", "paying shortcode (default profile shortcode)")
+	occasion := fs.String("occasion", "Payout", "occasion sent with the request")
+	async := defineAsyncFlags(fs, "Payout")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if err := required("phone", *phone, "amount", *amount); err != nil {
+			return nil, err
+		}
+		value, err := types.ParseAmount(*amount)
+		if err != nil {
+			return nil, err
+		}
+		initiator, credential, err := a.profile.initiator()
+		if err != nil {
+			return nil, err
+		}
+		resultURL, timeoutURL, err := async.urls(a.profile)
+		if err != nil {
+			return nil, err
+		}
+		return a.mpesa.B2CPayment(ctx, types.B2CPaymentRequest{
+			OriginatorConversationID: or(*id, rand.Text()),
+			InitiatorName:            initiator,
+			SecurityCredential:       credential,
+			CommandID:                types.B2CCommandID(*commandID),
+			Amount:                   value,
+			PartyA:                   or(*partyA, a.profile.ShortCode),
+			PartyB:                   *phone,
+			Remarks:                  *async.remarks,
+			QueueTimeOutURL:          timeoutURL,
+			ResultURL:                resultURL,
+			Occasion:                 *occasion,
+		})
+	}
+}
+
+// b2bCommand pays another business.
+func b2bCommand(fs *flag.FlagSet) action {
+	partyB := fs.String("to", "", "receiving shortcode")
+	amount := fs.String("amount", "", "amount in whole shillings")
+	account := fs.String("account", "", "account reference at the receiver")
+	commandID := fs.String("command", "BusinessPayBill", "B2B command ID, e.g. BusinessPayBill or BusinessBuyGoods")
+	partyA := fs.String("shortcode", "", "paying shortcode (default profile shortcode)")
+	senderType := fs.String("sender-type", "4", "identifier type of the paying shortcode")
+	receiverType := fs.String("receiver-type", "4", "identifier type of the receiving shortcode")
+	requester := fs.String("requester", "", "phone number of the customer the payment is made for")
+	async := defineAsyncFlags(fs, "Payment")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if err := required("to", *partyB, "amount", *amount, "account", *account, "requester", *requester); err != nil {
+			return nil, err
+		}
+		value, err := types.ParseAmount(*amount)
+		if err != nil {
+			return nil, err
+		}
+		initiator, credential, err := a.profile.initiator()
+		if err != nil {
+			return nil, err
+		}
+		resultURL, timeoutURL, err := async.urls(a.profile)
+		if err != nil {
+			return nil, err
+		}
+		return a.mpesa.B2BSend(ctx, types.B2BSendRequest{
+			Initiator:              initiator,
+			SecurityCredential:     credential,
+			CommandID:              *commandID,
+			SenderIdentifierType:   *senderType,
+			ReceiverIdentifierType: *receiverType,
+			Amount:                 value,
+			PartyA:                 or(*partyA, a.profile.ShortCode),
+			PartyB:                 *partyB,
+			Remarks:                *async.remarks,
+			AccountReference:       *account,
+			Requester:              *requester,
+			QueueTimeOutURL:        timeoutURL,
+			ResultURL:              resultURL,
+		})
+	}
+}
+
+// registerURLCommand registers the C2B URLs of a shortcode.
+func registerURLCommand(fs *flag.FlagSet) action {
+	shortCode := fs.String("shortcode", "", "shortcode to register (default profile shortcode)")
+	confirmationURL := fs.String("confirmation-url", "", "URL receiving payment confirmations")
+	validationURL := fs.String("validation-url", "", "URL validating payments")
+	responseType := fs.String("response-type", "Completed", "Completed or Cancelled, applied when the validation URL is unreachable")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		if err := required("confirmation-url", *confirmationURL, "validation-url", *validationURL); err != nil {
+			return nil, err
+		}
+		return a.mpesa.RegisterURL(ctx, types.RegisterURLRequest{
+			ShortCode:       or(*shortCode, a.profile.ShortCode),
+			ResponseType:    *responseType,
+			ConfirmationURL: *confirmationURL,
+			ValidationURL:   *validationURL,
+		})
+	}
+}
+
+// pullCommand pulls one page of transactions of a shortcode.
+func pullCommand(fs *flag.FlagSet) action {
+	shortCode := fs.String("shortcode", "", "shortcode to pull (default profile shortcode)")
+	today := time.Now().In(utils.Nairobi).Format("2006-01-02")
+	from := fs.String("from", today, "start date, YYYY-MM-DD")
+	to := fs.String("to", today, "end date, YYYY-MM-DD")
+	offset := fs.String("offset", "0", "number of transactions to skip")
+	return func(ctx context.Context, a *app) (interface{}, error) {
+		return a.mpesa.PullTransactions(ctx, types.PullTransactionsRequest{
+			ShortCode:   or(*shortCode, a.profile.ShortCode),
+			StartDate:   *from,
+			EndDate:     *to,
+			OffSetValue: *offset,
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/security"
+)
+
+// profile holds the credentials and defaults of one shortcode.
+type profile struct {
+	Environment        string `json:"environment"`
+	BaseURL            string `json:"base_url"`
+	ConsumerKey        string `json:"consumer_key"`
+	ConsumerSecret     string `json:"consumer_secret"`
+	ShortCode          string `json:"shortcode"`
+	Passkey            string `json:"passkey"`
+	Initiator          string `json:"initiator"`
+	SecurityCredential string `json:"security_credential"`
+	InitiatorPassword  string `json:"initiator_password"`
+	Certificate        string `json:"certificate"`
+	CallbackURL        string `json:"callback_url"`
+	ResultURL          string `json:"result_url"`
+	TimeoutURL         string `json:"timeout_url"`
+}
+
+// config is the layout of the config file.
+type config struct {
+	Profiles map[string]profile `json:"profiles"`
+}
+
+// defaultConfigPath returns the config file used when none is given.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mpesa", "config.json")
+}
+
+// loadProfile reads the named profile from the config file at path and
+// applies MPESA_* environment overrides. A missing config file is only an
+// error when path was given explicitly.
+func loadProfile(path, name string, explicit bool, getenv func(string) string) (*profile, error) {
+	p := &profile{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && !explicit:
+		case err != nil:
+			return nil, fmt.Errorf("failed to read config: %w", err)
+		default:
+			var cfg config
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				return nil, fmt.Errorf("invalid config %s: %w", path, err)
+			}
+			found, ok := cfg.Profiles[name]
+			if !ok && (explicit || name != "default") {
+				return nil, fmt.Errorf("profile %q not found in %s", name, path)
+			}
+			*p = found
+		}
+	}
+
+	for env, field := range map[string]*string{
+		"MPESA_ENVIRONMENT":         &p.Environment,
+		"MPESA_BASE_URL":            &p.BaseURL,
+		"MPESA_CONSUMER_KEY":        &p.ConsumerKey,
+		"MPESA_CONSUMER_SECRET":     &p.ConsumerSecret,
+		"MPESA_SHORTCODE":           &p.ShortCode,
+		"MPESA_PASSKEY":             &p.Passkey,
+		"MPESA_INITIATOR":           &p.Initiator,
+		"MPESA_SECURITY_CREDENTIAL": &p.SecurityCredential,
+		"MPESA_INITIATOR_PASSWORD":  &p.InitiatorPassword,
+		"MPESA_CERTIFICATE":         &p.Certificate,
+		"MPESA_CALLBACK_URL":        &p.CallbackURL,
+		"MPESA_RESULT_URL":          &p.ResultURL,
+		"MPESA_TIMEOUT_URL":         &p.TimeoutURL,
+	} {
+		if value := getenv(env); value != "" {
+			*field = value
+		}
+	}
+	return p, nil
+}
+
+// environment returns the Daraja environment of the profile.
+func (p *profile) environment() (client.Environment, error) {
+	if p.Environment == "" {
+		return client.Production, nil
+	}
+	return client.ParseEnvironment(p.Environment)
+}
+
+// options returns the client options for the profile.
+func (p *profile) options() ([]client.Option, error) {
+	env, err := p.environment()
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.Option{
+		client.WithEnvironment(env),
+		client.WithUserAgent("mpesa-cli"),
+		client.WithPhoneNormalization(),
+	}
+	if p.BaseURL != "" {
+		opts = append(opts, client.WithBaseURL(p.BaseURL))
+	}
+	if p.ConsumerKey != "" || p.ConsumerSecret != "" {
+		opts = append(opts, client.WithCredentials(p.ConsumerKey, p.ConsumerSecret))
+	}
+	if p.ShortCode != "" && p.Passkey != "" {
+		opts = append(opts, client.WithPasskey(p.ShortCode, p.Passkey))
+	}
+	return opts, nil
+}
+
+// securityCredential returns the configured security credential, encrypting
+// the initiator password when no ready-made credential is configured.
+func (p *profile) securityCredential() (string, error) {
+	if p.SecurityCredential != "" {
+		return p.SecurityCredential, nil
+	}
+	if p.InitiatorPassword == "" {
+		return "", errors.New("no security credential: set MPESA_SECURITY_CREDENTIAL or MPESA_INITIATOR_PASSWORD")
+	}
+	if p.Certificate != "" {
+		cert, err := security.LoadCertificate(p.Certificate)
+		if err != nil {
+			return "", err
+		}
+		return security.EncryptCredential(cert, p.InitiatorPassword)
+	}
+	env, err := p.environment()
+	if err != nil {
+		return "", err
+	}
+	bundled := security.ProductionCredential
+	if env == client.Sandbox {
+		bundled = security.SandboxCredential
+	}
+	credential, err := bundled(p.InitiatorPassword)
+	if errors.Is(err, security.ErrCertificateNotBundled) {
+		return "", fmt.Errorf("no %s certificate is bundled in this build: set MPESA_CERTIFICATE to the Daraja .cer file or set MPESA_SECURITY_CREDENTIAL", env)
+	}
+	return credential, err
+}
+
+// initiator returns the initiator name and security credential.
+func (p *profile) initiator() (string, string, error) {
+	if p.Initiator == "" {
+		return "", "", errors.New("no initiator: set MPESA_INITIATOR")
+	}
+	credential, err := p.securityCredential()
+	return p.Initiator, credential, err
+}
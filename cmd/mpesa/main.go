@@ -0,0 +1,150 @@
+// Command mpesa calls the Daraja APIs from the command line, for investigating
+// payments without writing a program.
+//
+//	mpesa <command> [flags]
+//
+// Credentials come from a profile in the config file
+// ($XDG_CONFIG_HOME/mpesa/config.json, or --config) and MPESA_* environment
+// variables, which take precedence:
+//
+//	{"profiles": {"default": {"environment": "sandbox", "consumer_key": "...", "consumer_secret": "...",
+//	  "shortcode": "174379", "passkey": "...", "initiator": "testapi", "initiator_password": "..."}}}
+//
+// Run "mpesa help" for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/freelancer254/mpesa-go/client"
+)
+
+// app is the state shared by commands.
+type app struct {
+	mpesa   *client.Mpesa
+	profile *profile
+}
+
+// action runs a command and returns the value to print.
+type action func(ctx context.Context, a *app) (interface{}, error)
+
+// command is a subcommand of the CLI. setup defines the command flags on fs
+// and returns the action to run once they are parsed.
+type command struct {
+	summary string
+	setup   func(fs *flag.FlagSet) action
+}
+
+// errUsage is returned after usage has been printed for invalid arguments.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr, os.Getenv); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "mpesa:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run executes the command line args.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, getenv func(string) string) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "mpesa: unknown command %q\n\n", args[0])
+		usage(stderr)
+		return errUsage
+	}
+
+	fs := flag.NewFlagSet("mpesa "+args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "", "config file (default $XDG_CONFIG_HOME/mpesa/config.json, or $MPESA_CONFIG)")
+	profileName := fs.String("profile", "", "config profile (default $MPESA_PROFILE, or \"default\")")
+	sandbox := fs.Bool("sandbox", false, "use the Daraja sandbox")
+	output := fs.String("o", "table", "output format: table or json")
+	baseURL := fs.String("base-url", "", "override the Daraja base URL")
+	act := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "mpesa %s: unexpected arguments %q\n", args[0], fs.Args())
+		return errUsage
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q, want table or json", *output)
+	}
+
+	path, explicit := *configPath, *configPath != ""
+	if !explicit {
+		path, explicit = getenv("MPESA_CONFIG"), getenv("MPESA_CONFIG") != ""
+	}
+	if !explicit {
+		path = defaultConfigPath()
+	}
+	name := *profileName
+	if name == "" {
+		name = getenv("MPESA_PROFILE")
+	}
+	if name == "" {
+		name = "default"
+	} else {
+		explicit = true
+	}
+	p, err := loadProfile(path, name, explicit, getenv)
+	if err != nil {
+		return err
+	}
+	if *sandbox {
+		p.Environment = string(client.Sandbox)
+	}
+	if *baseURL != "" {
+		p.BaseURL = *baseURL
+	}
+	opts, err := p.options()
+	if err != nil {
+		return err
+	}
+
+	result, err := act(ctx, &app{mpesa: client.NewMpesa(opts...), profile: p})
+	if err != nil {
+		return err
+	}
+	if *output == "json" {
+		return printJSON(stdout, result)
+	}
+	return printTable(stdout, result)
+}
+
+// usage prints the list of commands.
+func usage(w io.Writer) {
+	fmt.Fprint(w, "Usage: mpesa <command> [flags]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(tw, "  %s\t%s\n", name, commands[name].summary)
+	}
+	tw.Flush()
+	fmt.Fprint(w, "\nRun \"mpesa <command> -h\" for the flags of a command.\n")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/mpesatest"
+	"github.com/freelancer254/mpesa-go/security"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// env returns a getenv function serving the given variables.
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+// serverEnv returns the environment for a profile of the fake server, with
+// an empty config file.
+func serverEnv(t *testing.T, srv *mpesatest.Server) map[string]string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"profiles": {"default": {}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{
+		"MPESA_CONFIG":              path,
+		"MPESA_BASE_URL":            srv.URL,
+		"MPESA_CONSUMER_KEY":        mpesatest.ConsumerKey,
+		"MPESA_CONSUMER_SECRET":     mpesatest.ConsumerSecret,
+		"MPESA_SHORTCODE":           mpesatest.ShortCode,
+		"MPESA_PASSKEY":             mpesatest.Passkey,
+		"MPESA_INITIATOR":           "testapi",
+		"MPESA_SECURITY_CREDENTIAL": "credential",
+		"MPESA_CALLBACK_URL":        "https://example.com/stk",
+		"MPESA_RESULT_URL":          "https://example.com/result",
+	}
+}
+
+// runCLI runs the command line and returns its output.
+func runCLI(t *testing.T, vars map[string]string, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr, env(vars))
+	return stdout.String() + stderr.String(), err
+}
+
+// TestRun_Token tests fetching a token with credentials from the environment.
+func TestRun_Token(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	out, err := runCLI(t, serverEnv(t, srv), "token", "-o", "json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	var token types.AccessTokenResponse
+	if err := json.Unmarshal([]byte(out), &token); err != nil || token.AccessToken == "" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+// TestRun_STKPushWait tests an STK Push followed by polling for the outcome.
+func TestRun_STKPushWait(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	out, err := runCLI(t, serverEnv(t, srv), "stkpush", "-phone", "254708374149", "-amount", "10", "-reference", "INV-1", "-wait", "-poll", "1ms")
+	if err != nil {
+		t.Fatalf("expected no error, got %v: %s", err, out)
+	}
+	if !strings.Contains(out, "Status") || !strings.Contains(out, "succeeded") {
+		t.Errorf("expected a table with the succeeded status, got %q", out)
+	}
+}
+
+// TestRun_STKPushWaitJSON tests that the outcome status is printed by name in JSON output.
+func TestRun_STKPushWaitJSON(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	out, err := runCLI(t, serverEnv(t, srv), "stkpush", "-phone", "254708374149", "-amount", "10", "-reference", "INV-1", "-wait", "-poll", "1ms", "-o", "json")
+	if err != nil {
+		t.Fatalf("expected no error, got %v: %s", err, out)
+	}
+	var outcome types.STKOutcome
+	if err := json.Unmarshal([]byte(out), &outcome); err != nil || outcome.Status != types.STKSucceeded {
+		t.Errorf("unexpected output %q: %v", out, err)
+	}
+	if !strings.Contains(out, `"succeeded"`) {
+		t.Errorf("expected the status name, got %q", out)
+	}
+}
+
+// TestRun_B2C tests that initiator commands use the profile initiator and result URL.
+func TestRun_B2C(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	out, err := runCLI(t, serverEnv(t, srv), "b2c", "-phone", "0708 374 149", "-amount", "100", "-id", "payout-42")
+	if err != nil {
+		t.Fatalf("expected no error, got %v: %s", err, out)
+	}
+	if !strings.Contains(out, "payout-42") {
+		t.Errorf("expected the acknowledgement, got %q", out)
+	}
+	srv.Wait()
+	transactions := srv.Transactions()
+	if len(transactions) != 1 || transactions[0].MSISDN != "254708374149" || transactions[0].OriginatorConversationID != "payout-42" {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+}
+
+// TestRun_B2CGeneratedID tests that b2c identifies a payment without -id by a random OriginatorConversationID.
+func TestRun_B2CGeneratedID(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	for range 2 {
+		if out, err := runCLI(t, serverEnv(t, srv), "b2c", "-phone", "254708374149", "-amount", "100"); err != nil {
+			t.Fatalf("expected no error, got %v: %s", err, out)
+		}
+	}
+	srv.Wait()
+	transactions := srv.Transactions()
+	if len(transactions) != 2 || transactions[0].OriginatorConversationID == transactions[1].OriginatorConversationID {
+		t.Errorf("expected two payments with distinct IDs, got %+v", transactions)
+	}
+}
+
+// TestRun_InitiatorPassword tests that a credential is encrypted from the initiator password,
+// or that a missing certificate is reported clearly.
+func TestRun_InitiatorPassword(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	vars := serverEnv(t, srv)
+	delete(vars, "MPESA_SECURITY_CREDENTIAL")
+	vars["MPESA_INITIATOR_PASSWORD"] = "Safaricom999!*!"
+	out, err := runCLI(t, vars, "b2c", "-phone", "0708 374 149", "-amount", "100")
+	if _, bundledErr := security.SandboxCertificate(); bundledErr != nil {
+		if err == nil || !strings.Contains(err.Error(), "MPESA_CERTIFICATE") {
+			t.Errorf("expected a missing certificate error, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("expected no error, got %v: %s", err, out)
+	}
+}
+
+// TestRun_MissingFlag tests that missing required flags are reported.
+func TestRun_MissingFlag(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	_, err := runCLI(t, serverEnv(t, srv), "reverse", "-amount", "100")
+	if err == nil || !strings.Contains(err.Error(), "--id") {
+		t.Errorf("expected a missing --id error, got %v", err)
+	}
+}
+
+// TestRun_UnknownCommand tests that unknown commands print usage.
+func TestRun_UnknownCommand(t *testing.T) {
+	out, err := runCLI(t, nil, "refund")
+	if err != errUsage || !strings.Contains(out, "stkpush") {
+		t.Errorf("expected usage, got %v: %q", err, out)
+	}
+}
+
+// TestLoadProfile tests reading a profile from the config file with environment overrides.
+func TestLoadProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	config := `{"profiles": {"default": {"shortcode": "600000"}, "shop": {"environment": "sandbox", "shortcode": "174379", "consumer_key": "file-key"}}}`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := loadProfile(path, "shop", true, env(map[string]string{"MPESA_CONSUMER_KEY": "env-key"}))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if p.ShortCode != "174379" || p.ConsumerKey != "env-key" {
+		t.Errorf("unexpected profile %+v", p)
+	}
+	if env, err := p.environment(); err != nil || env != client.Sandbox {
+		t.Errorf("expected sandbox, got %q (%v)", env, err)
+	}
+
+	if _, err := loadProfile(path, "missing", true, env(nil)); err == nil {
+		t.Error("expected an error for an unknown profile")
+	}
+	if _, err := loadProfile(filepath.Join(t.TempDir(), "none.json"), "default", false, env(nil)); err != nil {
+		t.Errorf("expected a missing default config to be ignored, got %v", err)
+	}
+}
+
+// TestPrintTable tests that lists of structs are printed as tables.
+func TestPrintTable(t *testing.T) {
+	var out bytes.Buffer
+	err := printTable(&out, &types.PullTransactionsResponse{
+		ResponseCode: "1000",
+		Transactions: []types.Transaction{{TransactionID: "SIM0000001", Amount: 1000, Raw: json.RawMessage(`{"amount":"10.00"}`)}},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	for _, want := range []string{"ResponseCode", "1000", "Transactions:", "TRANSACTIONID", "SIM0000001", "10.00"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in output %q", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "RAW") {
+		t.Errorf("expected fields left out of JSON to be hidden, got %q", out.String())
+	}
+}
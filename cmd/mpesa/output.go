@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// printJSON prints v as indented JSON.
+func printJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printTable prints a struct as field/value rows, followed by a table for
+// each field holding a list of structs. A list of structs prints as a table.
+func printTable(w io.Writer, v interface{}) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() == reflect.Slice {
+		writeRows(tw, rv)
+		return tw.Flush()
+	}
+
+	var lists []reflect.Value
+	var listNames []string
+	writeFields(tw, "", rv, func(name string, list reflect.Value) {
+		listNames = append(listNames, name)
+		lists = append(lists, list)
+	})
+	for i, list := range lists {
+		fmt.Fprintf(tw, "\n%s:\n", listNames[i])
+		writeRows(tw, list)
+	}
+	return tw.Flush()
+}
+
+// leaf reports whether v prints as a single value.
+func leaf(v reflect.Value) bool {
+	if _, ok := v.Interface().(fmt.Stringer); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		return false
+	case reflect.Slice:
+		return v.Type().Elem().Kind() != reflect.Struct
+	}
+	return true
+}
+
+// shown reports whether a struct field is printed: exported fields that are
+// not left out of JSON.
+func shown(field reflect.StructField) bool {
+	return field.IsExported() && field.Tag.Get("json") != "-"
+}
+
+// writeFields writes the exported fields of struct v as rows, flattening
+// nested structs with a dotted prefix and passing lists of structs to list.
+func writeFields(w io.Writer, prefix string, v reflect.Value, list func(string, reflect.Value)) {
+	if v.Kind() != reflect.Struct {
+		fmt.Fprintf(w, "%s\t%s\n", strings.TrimSuffix(prefix, "."), format(v))
+		return
+	}
+	t := v.Type()
+	for i := range t.NumField() {
+		field, value := t.Field(i), v.Field(i)
+		if !shown(field) {
+			continue
+		}
+		name := prefix + field.Name
+		if field.Anonymous {
+			name = strings.TrimSuffix(prefix, ".")
+		}
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		switch {
+		case leaf(value):
+			fmt.Fprintf(w, "%s\t%s\n", name, format(value))
+		case value.Kind() == reflect.Slice:
+			if value.Len() > 0 {
+				list(name, value)
+			}
+		case field.Anonymous:
+			writeFields(w, prefix, value, list)
+		default:
+			writeFields(w, name+".", value, list)
+		}
+	}
+}
+
+// writeRows writes a list of structs as a table with a header row.
+func writeRows(w io.Writer, list reflect.Value) {
+	elem := list.Type().Elem()
+	if elem.Kind() != reflect.Struct {
+		for i := range list.Len() {
+			fmt.Fprintln(w, format(list.Index(i)))
+		}
+		return
+	}
+	var header []string
+	for i := range elem.NumField() {
+		if shown(elem.Field(i)) {
+			header = append(header, strings.ToUpper(elem.Field(i).Name))
+		}
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for i := range list.Len() {
+		var cells []string
+		for j := range elem.NumField() {
+			if shown(elem.Field(j)) {
+				cells = append(cells, format(list.Index(i).Field(j)))
+			}
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+}
+
+// format returns the printed form of a single value.
+func format(v reflect.Value) string {
+	if stringer, ok := v.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+		return string(v.Bytes())
+	}
+	return fmt.Sprint(v.Interface())
+}
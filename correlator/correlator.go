@@ -0,0 +1,222 @@
+// Package correlator matches the asynchronous results Daraja posts to a
+// ResultURL or QueueTimeOutURL with the requests that caused them, so callers
+// can wait for the final outcome of a B2C, B2B, reversal or transaction status
+// request by its ConversationID or OriginatorConversationID.
+package correlator
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/callback"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// DefaultPollInterval is how often the store is polled for outcomes received
+// by other replicas when it does not implement Watcher.
+const DefaultPollInterval = time.Second
+
+// Outcome is the final outcome of an asynchronous request.
+type Outcome struct {
+	// Result is the result posted to the ResultURL or QueueTimeOutURL.
+	Result *types.Result
+	// TimedOut is set when the outcome came from the QueueTimeOutURL.
+	TimedOut bool
+}
+
+// Correlator delivers results to the callers awaiting them.
+type Correlator struct {
+	store        Store
+	pollInterval time.Duration
+
+	mu      sync.Mutex
+	waiters map[string][]chan *Outcome
+}
+
+// New returns a Correlator backed by store. A nil store uses a MemoryStore.
+// A pollInterval of zero uses DefaultPollInterval.
+func New(store Store, pollInterval time.Duration) *Correlator {
+	if store == nil {
+		store = NewMemoryStore()
+	}
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	return &Correlator{
+		store:        store,
+		pollInterval: pollInterval,
+		waiters:      make(map[string][]chan *Outcome),
+	}
+}
+
+// Pending is a request registered with a Correlator, awaiting its outcome.
+type Pending struct {
+	c   *Correlator
+	ids []string
+	ch  chan *Outcome
+}
+
+// Register starts listening for the outcome of a request identified by any of
+// ids, typically the ConversationID and OriginatorConversationID of the
+// acknowledgement. Register before the result can arrive and call Wait or
+// Cancel on the returned Pending.
+func (c *Correlator) Register(ids ...string) *Pending {
+	p := &Pending{c: c, ch: make(chan *Outcome, 1)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		p.ids = append(p.ids, id)
+		c.waiters[id] = append(c.waiters[id], p.ch)
+	}
+	return p
+}
+
+// Await waits for the outcome of the request identified by id.
+func (c *Correlator) Await(ctx context.Context, id string) (*Outcome, error) {
+	return c.Register(id).Wait(ctx)
+}
+
+// Wait blocks until the outcome arrives, locally or through the store, or
+// until ctx is done.
+func (p *Pending) Wait(ctx context.Context) (*Outcome, error) {
+	defer p.Cancel()
+	if len(p.ids) == 0 {
+		return nil, errors.New("no conversation ID to await")
+	}
+
+	var watched <-chan *Outcome
+	if watcher, ok := p.c.store.(Watcher); ok {
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		ch, err := p.watch(watchCtx, watcher)
+		if err != nil {
+			return nil, err
+		}
+		watched = ch
+	}
+
+	ticker := time.NewTicker(p.c.pollInterval)
+	defer ticker.Stop()
+	for {
+		if outcome, err := p.load(ctx); outcome != nil || err != nil {
+			return outcome, err
+		}
+		select {
+		case outcome := <-p.ch:
+			return outcome, nil
+		case outcome := <-watched:
+			return outcome, nil
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// watch watches every ID of the request and merges the outcomes into one
+// channel. Watches end when ctx is done.
+func (p *Pending) watch(ctx context.Context, watcher Watcher) (<-chan *Outcome, error) {
+	merged := make(chan *Outcome, len(p.ids))
+	for _, id := range p.ids {
+		ch, err := watcher.Watch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		go func() {
+			select {
+			case outcome, ok := <-ch:
+				if ok && outcome != nil {
+					merged <- outcome
+				}
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return merged, nil
+}
+
+// load returns the outcome saved in the store under any of the IDs, if any.
+func (p *Pending) load(ctx context.Context) (*Outcome, error) {
+	for _, id := range p.ids {
+		outcome, err := p.c.store.Load(ctx, id)
+		if err == nil {
+			return outcome, nil
+		}
+		if !errors.Is(err, ErrPending) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Cancel stops listening for the outcome.
+func (p *Pending) Cancel() {
+	p.c.mu.Lock()
+	defer p.c.mu.Unlock()
+	for _, id := range p.ids {
+		chans := p.c.waiters[id]
+		for i, ch := range chans {
+			if ch == p.ch {
+				chans = append(chans[:i], chans[i+1:]...)
+				break
+			}
+		}
+		if len(chans) == 0 {
+			delete(p.c.waiters, id)
+		} else {
+			p.c.waiters[id] = chans
+		}
+	}
+}
+
+// Deliver saves an outcome under its ConversationID and
+// OriginatorConversationID and wakes up local waiters.
+func (c *Correlator) Deliver(ctx context.Context, outcome *Outcome) error {
+	ids := []string{outcome.Result.ConversationID, outcome.Result.OriginatorConversationID}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if err := c.store.Save(ctx, id, outcome); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range ids {
+		for _, ch := range c.waiters[id] {
+			select {
+			case ch <- outcome:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// OnResult delivers a result; it matches the function taken by callback.ResultHandler.
+func (c *Correlator) OnResult(ctx context.Context, result *types.Result) error {
+	return c.Deliver(ctx, &Outcome{Result: result})
+}
+
+// OnTimeout delivers a timeout; it matches the function taken by callback.TimeoutHandler.
+func (c *Correlator) OnTimeout(ctx context.Context, result *types.Result) error {
+	return c.Deliver(ctx, &Outcome{Result: result, TimedOut: true})
+}
+
+// ResultHandler returns an http.Handler for a ResultURL that feeds the correlator.
+func (c *Correlator) ResultHandler() http.Handler {
+	return callback.ResultHandler(c.OnResult)
+}
+
+// TimeoutHandler returns an http.Handler for a QueueTimeOutURL that feeds the correlator.
+func (c *Correlator) TimeoutHandler() http.Handler {
+	return callback.TimeoutHandler(c.OnTimeout)
+}
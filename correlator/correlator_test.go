@@ -0,0 +1,161 @@
+// Package correlator_test contains unit tests for the result correlator.
+package correlator_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/correlator"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+const result = `{"Result":{"ResultType":0,"ResultCode":0,"ResultDesc":"The service request is processed successfully.","OriginatorConversationID":"10571-7910404-1","ConversationID":"AG_20191219_00004e48cf7e3533f581","TransactionID":"NLJ41HAY6Q","ResultParameters":{"ResultParameter":[{"Key":"TransactionAmount","Value":10},{"Key":"TransactionReceipt","Value":"NLJ41HAY6Q"}]}}}`
+
+// post sends body to handler and reports a non-200 response.
+func post(t *testing.T, handler http.Handler, body string) {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/result", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", rec.Code)
+	}
+}
+
+// TestAwait_Local tests awaiting a result delivered to the same correlator.
+func TestAwait_Local(t *testing.T) {
+	c := correlator.New(nil, time.Hour)
+	pending := c.Register("AG_20191219_00004e48cf7e3533f581", "10571-7910404-1")
+
+	go post(t, c.ResultHandler(), result)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	outcome, err := pending.Wait(ctx)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outcome.TimedOut || !outcome.Result.Success() {
+		t.Errorf("unexpected outcome %+v", outcome)
+	}
+	b2c, err := outcome.Result.AsB2C()
+	if err != nil || b2c.TransactionReceipt != "NLJ41HAY6Q" {
+		t.Errorf("unexpected B2C result %+v (%v)", b2c, err)
+	}
+}
+
+// TestAwait_SharedStore tests awaiting a result received by another replica.
+func TestAwait_SharedStore(t *testing.T) {
+	store := correlator.NewMemoryStore()
+	receiver := correlator.New(store, 0)
+	waiter := correlator.New(store, 10*time.Millisecond)
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		post(t, receiver.TimeoutHandler(), result)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	outcome, err := waiter.Await(ctx, "10571-7910404-1")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !outcome.TimedOut {
+		t.Errorf("expected timeout outcome, got %+v", outcome)
+	}
+}
+
+// TestAwait_ContextDone tests that Await gives up when the context is done.
+func TestAwait_ContextDone(t *testing.T) {
+	c := correlator.New(nil, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Await(ctx, "AG_unknown"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+// TestDeliver_BeforeAwait tests that a result delivered before Await is still found.
+func TestDeliver_BeforeAwait(t *testing.T) {
+	c := correlator.New(nil, 0)
+	res := &types.Result{ConversationID: "AG_1", OriginatorConversationID: "1-1", ResultCode: "0"}
+	if err := c.OnResult(context.Background(), res); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	outcome, err := c.Await(context.Background(), "AG_1")
+	if err != nil || outcome.Result != res {
+		t.Errorf("unexpected outcome %+v (%v)", outcome, err)
+	}
+}
+
+// watchingStore is a MemoryStore that pushes saved outcomes to watchers.
+type watchingStore struct {
+	*correlator.MemoryStore
+
+	mu       sync.Mutex
+	watchers map[string][]chan *correlator.Outcome
+}
+
+// Save implements correlator.Store.
+func (s *watchingStore) Save(ctx context.Context, id string, outcome *correlator.Outcome) error {
+	if err := s.MemoryStore.Save(ctx, id, outcome); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.watchers[id] {
+		ch <- outcome
+	}
+	delete(s.watchers, id)
+	return nil
+}
+
+// Watch implements correlator.Watcher.
+func (s *watchingStore) Watch(ctx context.Context, id string) (<-chan *correlator.Outcome, error) {
+	ch := make(chan *correlator.Outcome, 1)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers[id] = append(s.watchers[id], ch)
+	return ch, nil
+}
+
+// TestAwait_WatchesEveryID tests that an outcome saved under the second registered ID is pushed without polling.
+func TestAwait_WatchesEveryID(t *testing.T) {
+	store := &watchingStore{MemoryStore: correlator.NewMemoryStore(), watchers: make(map[string][]chan *correlator.Outcome)}
+	receiver := correlator.New(store, 0)
+	waiter := correlator.New(store, time.Hour)
+	pending := waiter.Register("AG_1", "1-1")
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		receiver.OnResult(context.Background(), &types.Result{OriginatorConversationID: "1-1", ResultCode: "0"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	outcome, err := pending.Wait(ctx)
+	if err != nil || outcome.Result.OriginatorConversationID != "1-1" {
+		t.Errorf("unexpected outcome %+v (%v)", outcome, err)
+	}
+}
+
+// TestMemoryStore_TTL tests that expired outcomes are no longer loaded.
+func TestMemoryStore_TTL(t *testing.T) {
+	store := correlator.NewMemoryStore()
+	store.TTL = 10 * time.Millisecond
+	if err := store.Save(context.Background(), "AG_1", &correlator.Outcome{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := store.Load(context.Background(), "AG_1"); err != nil {
+		t.Fatalf("expected the outcome, got %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.Load(context.Background(), "AG_1"); !errors.Is(err, correlator.ErrPending) {
+		t.Errorf("expected ErrPending, got %v", err)
+	}
+}
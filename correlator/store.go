@@ -0,0 +1,104 @@
+package correlator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPending is returned by Store.Load when no outcome has been saved for an ID.
+var ErrPending = errors.New("result pending")
+
+// Store persists outcomes so that a result received by one replica can be
+// awaited by another. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save records the outcome under id.
+	Save(ctx context.Context, id string, outcome *Outcome) error
+	// Load returns the outcome saved under id, or ErrPending.
+	Load(ctx context.Context, id string) (*Outcome, error)
+	// Delete removes the outcome saved under id.
+	Delete(ctx context.Context, id string) error
+}
+
+// Watcher is optionally implemented by a Store that can push outcomes, e.g.
+// through pub/sub, instead of being polled.
+type Watcher interface {
+	// Watch returns a channel that receives the outcome for id once saved.
+	// The watch ends when ctx is done.
+	Watch(ctx context.Context, id string) (<-chan *Outcome, error)
+}
+
+// MemoryStore is an in-process Store. It only correlates within a single
+// replica; use a shared Store to correlate across replicas.
+type MemoryStore struct {
+	// TTL is how long outcomes are kept; zero keeps them for 24 hours.
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	swept   time.Time
+}
+
+// memoryEntry is an outcome and the time it was saved.
+type memoryEntry struct {
+	outcome *Outcome
+	savedAt time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+// ttl returns how long outcomes are kept.
+func (s *MemoryStore) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return 24 * time.Hour
+	}
+	return s.TTL
+}
+
+// Save implements Store. Expired outcomes are dropped by Load, and swept
+// from the whole store at most once per TTL so that Save stays cheap.
+func (s *MemoryStore) Save(ctx context.Context, id string, outcome *Outcome) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.entries == nil {
+		s.entries = make(map[string]memoryEntry)
+	}
+	now := time.Now()
+	if ttl := s.ttl(); now.Sub(s.swept) > ttl {
+		for key, entry := range s.entries {
+			if now.Sub(entry.savedAt) > ttl {
+				delete(s.entries, key)
+			}
+		}
+		s.swept = now
+	}
+	s.entries[id] = memoryEntry{outcome: outcome, savedAt: now}
+	return nil
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(ctx context.Context, id string) (*Outcome, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrPending
+	}
+	if time.Since(entry.savedAt) > s.ttl() {
+		delete(s.entries, id)
+		return nil, ErrPending
+	}
+	return entry.outcome, nil
+}
+
+// Delete implements Store.
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+	return nil
+}
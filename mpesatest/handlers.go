@@ -0,0 +1,969 @@
+package mpesatest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/phone"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// Limits Daraja applies to transaction amounts, in whole shillings.
+const (
+	maxSTKAmount = 250000
+	minB2CAmount = 10
+	maxB2CAmount = 250000
+)
+
+// acceptedDescription is the ResponseDescription of accepted asynchronous requests.
+const acceptedDescription = "Accept the service request successfully."
+
+// param is a ResultParameter or ReferenceItem in a result callback.
+type param struct {
+	Key   string      `json:"Key"`
+	Value interface{} `json:"Value"`
+}
+
+// asyncResult is a result delivered to a ResultURL.
+type asyncResult struct {
+	code   string
+	desc   string
+	txID   string
+	params []param
+}
+
+// missing returns the first of fields that is absent from body.
+func missing(body map[string]string, fields ...string) string {
+	for _, field := range fields {
+		if strings.TrimSpace(body[field]) == "" {
+			return field
+		}
+	}
+	return ""
+}
+
+// numeric reports whether s consists of digits only.
+func numeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validURL reports whether s is an absolute http or https URL.
+func validURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// wholeAmount parses a whole shilling amount within [min, max]; max <= 0 means no upper limit.
+func wholeAmount(s string, min, max int64) (types.Amount, bool) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < min || (max > 0 && n > max) {
+		return 0, false
+	}
+	return types.Amount(n * 100), true
+}
+
+// invalid writes the error Daraja returns for an invalid request field.
+func invalid(w http.ResponseWriter, field string) {
+	writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid "+field)
+}
+
+// accepted writes the acknowledgement of an asynchronous request.
+func accepted(w http.ResponseWriter, conversationID, originatorConversationID string) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ConversationID":           conversationID,
+		"OriginatorConversationID": originatorConversationID,
+		"ResponseCode":             "0",
+		"ResponseDescription":      acceptedDescription,
+	})
+}
+
+// resultPayload builds the body posted to a ResultURL.
+func resultPayload(conversationID, originatorConversationID string, result asyncResult) map[string]interface{} {
+	body := map[string]interface{}{
+		"ResultType":               0,
+		"ResultCode":               result.code,
+		"ResultDesc":               result.desc,
+		"OriginatorConversationID": originatorConversationID,
+		"ConversationID":           conversationID,
+		"TransactionID":            result.txID,
+	}
+	if len(result.params) > 0 {
+		body["ResultParameters"] = map[string]interface{}{"ResultParameter": result.params}
+	}
+	body["ReferenceData"] = map[string]interface{}{
+		"ReferenceItem": param{Key: "QueueTimeoutURL", Value: "https://internalsandbox.safaricom.co.ke/mpesa/b2cresults/v1/submit"},
+	}
+	return map[string]interface{}{"Result": body}
+}
+
+// failedResult returns a result with the given code and its catalogued description.
+func failedResult(code, desc string) asyncResult {
+	if desc == "" {
+		desc = types.ResultCodeDescription(code)
+	}
+	return asyncResult{code: code, desc: desc}
+}
+
+// record appends a completed transaction. s.mu must be held.
+func (s *Server) record(tx *Transaction) {
+	s.transactions = append(s.transactions, tx)
+}
+
+// find returns the transaction with the given receipt or OriginatorConversationID. s.mu must be held.
+func (s *Server) find(id string) *Transaction {
+	for _, tx := range s.transactions {
+		if tx.ID == id || (tx.OriginatorConversationID != "" && tx.OriginatorConversationID == id) {
+			return tx
+		}
+	}
+	return nil
+}
+
+// handleSTKPush starts an STK Push and delivers its callback after the callback delay.
+func (s *Server) handleSTKPush(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "BusinessShortCode", "Password", "Timestamp", "TransactionType", "Amount",
+		"PartyA", "PartyB", "PhoneNumber", "CallBackURL", "AccountReference", "TransactionDesc"); field != "" {
+		invalid(w, field)
+		return
+	}
+	shortCode := body["BusinessShortCode"]
+	switch {
+	case !numeric(shortCode):
+		invalid(w, "BusinessShortCode")
+		return
+	case body["TransactionType"] != "CustomerPayBillOnline" && body["TransactionType"] != "CustomerBuyGoodsOnline":
+		invalid(w, "TransactionType")
+		return
+	case !phone.Valid(body["PhoneNumber"]):
+		invalid(w, "PhoneNumber")
+		return
+	case !validURL(body["CallBackURL"]):
+		invalid(w, "CallBackURL")
+		return
+	}
+	if _, err := utils.ParseTimestamp(body["Timestamp"]); err != nil {
+		invalid(w, "Timestamp")
+		return
+	}
+	amount, ok := wholeAmount(body["Amount"], 1, maxSTKAmount)
+	if !ok {
+		invalid(w, "Amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if passkey, ok := s.passkeys[shortCode]; ok && body["Password"] != stkPassword(shortCode, passkey, body["Timestamp"]) {
+		writeError(w, http.StatusInternalServerError, "500.001.1001", "Wrong credentials")
+		return
+	}
+	resultCode, ok := s.stkResults[body["PhoneNumber"]]
+	if !ok {
+		resultCode = s.stkResults[""]
+	}
+	if resultCode == "" {
+		resultCode = types.ResultCodeSuccess
+	}
+	req := &stkRequest{
+		merchantRequestID: s.nextID("29115-34620561-"),
+		checkoutRequestID: "ws_CO_" + s.nextID(time.Now().In(utils.Nairobi).Format("02012006150405")),
+		resultCode:        resultCode,
+	}
+	s.stk[req.checkoutRequestID] = req
+
+	tx := &Transaction{
+		Type:          body["TransactionType"],
+		Amount:        amount,
+		ShortCode:     shortCode,
+		MSISDN:        body["PhoneNumber"],
+		BillReference: body["AccountReference"],
+	}
+	s.deliver(body["CallBackURL"], s.callbackDelay, func() interface{} {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		req.done = true
+		callback := map[string]interface{}{
+			"MerchantRequestID": req.merchantRequestID,
+			"CheckoutRequestID": req.checkoutRequestID,
+			"ResultCode":        resultCodeNumber(resultCode),
+			"ResultDesc":        stkResultDescription(resultCode),
+		}
+		if resultCode == types.ResultCodeSuccess {
+			tx.ID = s.nextReceipt()
+			tx.Time = time.Now().In(utils.Nairobi)
+			s.balance += tx.Amount
+			s.record(tx)
+			callback["CallbackMetadata"] = map[string]interface{}{
+				"Item": []map[string]interface{}{
+					{"Name": "Amount", "Value": json.Number(tx.Amount.String())},
+					{"Name": "MpesaReceiptNumber", "Value": tx.ID},
+					{"Name": "Balance"},
+					{"Name": "TransactionDate", "Value": json.Number(utils.FormatTimestamp(tx.Time))},
+					{"Name": "PhoneNumber", "Value": json.Number(tx.MSISDN)},
+				},
+			}
+		}
+		return map[string]interface{}{"Body": map[string]interface{}{"stkCallback": callback}}
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"MerchantRequestID":   req.merchantRequestID,
+		"CheckoutRequestID":   req.checkoutRequestID,
+		"ResponseCode":        "0",
+		"ResponseDescription": "Success. Request accepted for processing",
+		"CustomerMessage":     "Success. Request accepted for processing",
+	})
+}
+
+// resultCodeNumber returns numeric result codes as numbers, the way Daraja sends them.
+func resultCodeNumber(code string) interface{} {
+	if n, err := strconv.Atoi(code); err == nil {
+		return n
+	}
+	return code
+}
+
+// stkResultDescription returns the ResultDesc of an STK Push result code.
+func stkResultDescription(code string) string {
+	if code == types.ResultCodeSuccess {
+		return "The service request is processed successfully."
+	}
+	if desc := types.ResultCodeDescription(code); desc != "" {
+		return desc
+	}
+	return "The transaction failed."
+}
+
+// handleSTKPushQuery reports the state of an STK Push.
+func (s *Server) handleSTKPushQuery(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "BusinessShortCode", "Password", "Timestamp", "CheckoutRequestID"); field != "" {
+		invalid(w, field)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shortCode := body["BusinessShortCode"]
+	if passkey, ok := s.passkeys[shortCode]; ok && body["Password"] != stkPassword(shortCode, passkey, body["Timestamp"]) {
+		writeError(w, http.StatusInternalServerError, "500.001.1001", "Wrong credentials")
+		return
+	}
+	req, ok := s.stk[body["CheckoutRequestID"]]
+	if !ok {
+		invalid(w, "CheckoutRequestID")
+		return
+	}
+	if !req.done {
+		writeError(w, http.StatusInternalServerError, "500.001.1001", "The transaction is being processed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ResponseCode":        "0",
+		"ResponseDescription": "The service request has been accepted successsfully",
+		"MerchantRequestID":   req.merchantRequestID,
+		"CheckoutRequestID":   req.checkoutRequestID,
+		"ResultCode":          req.resultCode,
+		"ResultDesc":          stkResultDescription(req.resultCode),
+	})
+}
+
+// handleRegisterURL registers the C2B validation and confirmation URLs of a shortcode.
+func (s *Server) handleRegisterURL(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "ShortCode", "ResponseType", "ConfirmationURL", "ValidationURL"); field != "" {
+		invalid(w, field)
+		return
+	}
+	switch {
+	case !numeric(body["ShortCode"]):
+		invalid(w, "ShortCode")
+		return
+	case body["ResponseType"] != "Completed" && body["ResponseType"] != "Cancelled":
+		invalid(w, "ResponseType")
+		return
+	case !validURL(body["ConfirmationURL"]):
+		invalid(w, "ConfirmationURL")
+		return
+	case !validURL(body["ValidationURL"]):
+		invalid(w, "ValidationURL")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.c2b[body["ShortCode"]] = c2bURLs{
+		validation:   body["ValidationURL"],
+		confirmation: body["ConfirmationURL"],
+		responseType: body["ResponseType"],
+	}
+	_, originatorID := s.conversationIDs()
+	writeJSON(w, http.StatusOK, map[string]string{
+		"OriginatorCoversationID": originatorID,
+		"ResponseCode":            "0",
+		"ResultCode":              "0",
+		"ResponseDescription":     "Success",
+	})
+}
+
+// handleSimulate simulates a customer payment to a shortcode with registered
+// URLs. The payment is validated against the validation URL and, if accepted,
+// recorded and posted to the confirmation URL.
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "ShortCode", "CommandID", "Amount", "Msisdn"); field != "" {
+		invalid(w, field)
+		return
+	}
+	commandID := body["CommandID"]
+	switch {
+	case commandID != "CustomerPayBillOnline" && commandID != "CustomerBuyGoodsOnline":
+		invalid(w, "CommandID")
+		return
+	case commandID == "CustomerPayBillOnline" && body["BillRefNumber"] == "":
+		invalid(w, "BillRefNumber")
+		return
+	case !phone.Valid(body["Msisdn"]):
+		invalid(w, "Msisdn")
+		return
+	}
+	amount, ok := wholeAmount(body["Amount"], 1, 0)
+	if !ok {
+		invalid(w, "Amount")
+		return
+	}
+
+	s.mu.Lock()
+	urls, ok := s.c2b[body["ShortCode"]]
+	if !ok {
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid ShortCode: URLs not registered")
+		return
+	}
+	conversationID, originatorID := s.conversationIDs()
+	tx := &Transaction{
+		ID:                       s.nextReceipt(),
+		Type:                     commandID,
+		Time:                     time.Now().In(utils.Nairobi),
+		Amount:                   amount,
+		ShortCode:                body["ShortCode"],
+		MSISDN:                   body["Msisdn"],
+		BillReference:            body["BillRefNumber"],
+		Sender:                   "John Doe",
+		ConversationID:           conversationID,
+		OriginatorConversationID: originatorID,
+	}
+	s.mu.Unlock()
+
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		s.completeC2B(urls, tx)
+	}()
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ConversationID":           conversationID,
+		"OriginatorConversationID": originatorID,
+		"ResponseDescription":      acceptedDescription,
+	})
+}
+
+// completeC2B runs the validation and confirmation of a simulated C2B payment.
+func (s *Server) completeC2B(urls c2bURLs, tx *Transaction) {
+	transactionType := "Pay Bill"
+	if tx.Type == "CustomerBuyGoodsOnline" {
+		transactionType = "Buy Goods"
+	}
+	payload := types.C2BTransaction{
+		TransactionType:   transactionType,
+		TransID:           tx.ID,
+		TransTime:         utils.FormatTimestamp(tx.Time),
+		TransAmount:       tx.Amount,
+		BusinessShortCode: tx.ShortCode,
+		BillRefNumber:     tx.BillReference,
+		MSISDN:            tx.MSISDN,
+		FirstName:         "John",
+		LastName:          "Doe",
+	}
+
+	var decision types.C2BValidationResponse
+	if err := s.post(urls.validation, payload, &decision); err != nil {
+		// Daraja falls back to the registered ResponseType when the
+		// validation URL cannot be reached.
+		if urls.responseType != "Completed" {
+			return
+		}
+	} else if decision.ResultCode != types.C2BAccepted {
+		return
+	}
+
+	s.mu.Lock()
+	s.balance += tx.Amount
+	payload.OrgAccountBalance = s.balance
+	s.record(tx)
+	s.mu.Unlock()
+	s.post(urls.confirmation, payload, nil)
+}
+
+// asyncFields are the fields every asynchronous request must carry besides its own.
+var asyncFields = []string{"SecurityCredential", "CommandID", "QueueTimeOutURL", "ResultURL"}
+
+// checkAsync validates the fields common to asynchronous requests.
+func checkAsync(w http.ResponseWriter, body map[string]string, initiator string, fields ...string) bool {
+	fields = append(append([]string{initiator}, asyncFields...), fields...)
+	if field := missing(body, fields...); field != "" {
+		invalid(w, field)
+		return false
+	}
+	for _, field := range []string{"QueueTimeOutURL", "ResultURL"} {
+		if !validURL(body[field]) {
+			invalid(w, field)
+			return false
+		}
+	}
+	return true
+}
+
+// handleReversal reverses a recorded transaction.
+func (s *Server) handleReversal(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if !checkAsync(w, body, "Initiator", "TransactionID", "Amount", "ReceiverParty", "ReceiverIdentifierType", "Remarks") {
+		return
+	}
+	if body["CommandID"] != "TransactionReversal" {
+		invalid(w, "CommandID")
+		return
+	}
+	amount, ok := wholeAmount(body["Amount"], 1, 0)
+	if !ok {
+		invalid(w, "Amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversationID, originatorID := s.conversationIDs()
+	var result asyncResult
+	switch tx := s.find(body["TransactionID"]); {
+	case tx == nil:
+		result = failedResult(ResultCodeTransactionNotFound, "The transaction does not exist.")
+	case tx.Reversed:
+		result = failedResult(ResultCodeAlreadyReversed, "The transaction has already been reversed.")
+	case tx.Amount != amount:
+		result = failedResult("R000003", "The reversal amount does not match the transaction amount.")
+	default:
+		tx.Reversed = true
+		s.balance -= tx.Amount
+		now := time.Now().In(utils.Nairobi)
+		reversal := &Transaction{
+			ID:                       s.nextReceipt(),
+			Type:                     "TransactionReversal",
+			Time:                     now,
+			Amount:                   tx.Amount,
+			ShortCode:                tx.ShortCode,
+			MSISDN:                   tx.MSISDN,
+			ConversationID:           conversationID,
+			OriginatorConversationID: originatorID,
+		}
+		s.record(reversal)
+		result = asyncResult{
+			code: types.ResultCodeSuccess,
+			desc: "The service request is processed successfully.",
+			txID: reversal.ID,
+			params: []param{
+				{"DebitAccountBalance", "Utility Account|KES|" + s.balance.String() + "|" + s.balance.String() + "|0.00|0.00"},
+				{"Amount", tx.Amount.String()},
+				{"TransCompletedTime", utils.FormatTimestamp(now)},
+				{"OriginalTransactionID", tx.ID},
+				{"Charge", "0.00"},
+				{"CreditPartyPublicName", tx.MSISDN + " - John Doe"},
+				{"DebitPartyPublicName", tx.ShortCode + " - Test Shop"},
+			},
+		}
+	}
+	payload := resultPayload(conversationID, originatorID, result)
+	s.deliver(body["ResultURL"], s.callbackDelay, func() interface{} { return payload })
+	accepted(w, conversationID, originatorID)
+}
+
+// handleTransactionQuery reports the status of a recorded transaction.
+func (s *Server) handleTransactionQuery(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if !checkAsync(w, body, "Initiator", "PartyA", "IdentifierType", "Remarks") {
+		return
+	}
+	id := body["TransactionID"]
+	if id == "" {
+		id = body["OriginatorConversationID"]
+	}
+	if id == "" {
+		invalid(w, "TransactionID")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversationID, originatorID := s.conversationIDs()
+	var result asyncResult
+	if tx := s.find(id); tx == nil {
+		result = failedResult(ResultCodeTransactionNotFound, "The transaction does not exist.")
+	} else {
+		status := "Completed"
+		if tx.Reversed {
+			status = "Reversed"
+		}
+		completed := utils.FormatTimestamp(tx.Time)
+		result = asyncResult{
+			code: types.ResultCodeSuccess,
+			desc: "The service request is processed successfully.",
+			txID: tx.ID,
+			params: []param{
+				{"DebitPartyName", tx.MSISDN + " - John Doe"},
+				{"CreditPartyName", tx.ShortCode + " - Test Shop"},
+				{"OriginatorConversationID", originatorID},
+				{"InitiatedTime", completed},
+				{"DebitAccountType", "MMF Account For Customer"},
+				{"DebitPartyCharges", ""},
+				{"TransactionReason", ""},
+				{"ReasonType", tx.Type},
+				{"TransactionStatus", status},
+				{"FinalisedTime", completed},
+				{"Amount", tx.Amount.String()},
+				{"ConversationID", tx.ConversationID},
+				{"ReceiptNo", tx.ID},
+			},
+		}
+	}
+	payload := resultPayload(conversationID, originatorID, result)
+	s.deliver(body["ResultURL"], s.callbackDelay, func() interface{} { return payload })
+	accepted(w, conversationID, originatorID)
+}
+
+// handleBalance reports the working account balance.
+func (s *Server) handleBalance(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if !checkAsync(w, body, "Initiator", "PartyA", "IdentifierType", "Remarks") {
+		return
+	}
+	if body["CommandID"] != "AccountBalance" {
+		invalid(w, "CommandID")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversationID, originatorID := s.conversationIDs()
+	balance := s.balance.String()
+	result := asyncResult{
+		code: types.ResultCodeSuccess,
+		desc: "The service request is processed successfully.",
+		txID: s.nextReceipt(),
+		params: []param{
+			{"AccountBalance", "Working Account|KES|" + balance + "|" + balance + "|0.00|0.00" +
+				"&Utility Account|KES|0.00|0.00|0.00|0.00" +
+				"&Charges Paid Account|KES|0.00|0.00|0.00|0.00"},
+			{"BOCompletedTime", utils.FormatTimestamp(time.Now().In(utils.Nairobi))},
+		},
+	}
+	payload := resultPayload(conversationID, originatorID, result)
+	s.deliver(body["ResultURL"], s.callbackDelay, func() interface{} { return payload })
+	accepted(w, conversationID, originatorID)
+}
+
+// handleB2C pays a customer from the working account.
+func (s *Server) handleB2C(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	s.b2c(w, body, "")
+}
+
+// handleB2CV3 pays a customer like handleB2C, under the caller's
+// OriginatorConversationID. A repeated ID is acknowledged again without paying
+// twice, the way Daraja deduplicates v3 payments.
+func (s *Server) handleB2CV3(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if body["OriginatorConversationID"] == "" {
+		invalid(w, "OriginatorConversationID")
+		return
+	}
+	s.b2c(w, body, body["OriginatorConversationID"])
+}
+
+// b2c pays a customer, identifying the payment by originatorID if set.
+func (s *Server) b2c(w http.ResponseWriter, body map[string]string, originatorID string) {
+	if !checkAsync(w, body, "InitiatorName", "Amount", "PartyA", "PartyB", "Remarks") {
+		return
+	}
+	switch body["CommandID"] {
+	case "SalaryPayment", "BusinessPayment", "PromotionPayment":
+	default:
+		invalid(w, "CommandID")
+		return
+	}
+	if !numeric(body["PartyA"]) {
+		invalid(w, "PartyA")
+		return
+	}
+	if !phone.Valid(body["PartyB"]) {
+		invalid(w, "PartyB")
+		return
+	}
+	amount, ok := wholeAmount(body["Amount"], minB2CAmount, maxB2CAmount)
+	if !ok {
+		invalid(w, "Amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if conversationID, ok := s.b2cV3[originatorID]; ok {
+		accepted(w, conversationID, originatorID)
+		return
+	}
+	conversationID, generatedID := s.conversationIDs()
+	if originatorID == "" {
+		originatorID = generatedID
+	} else {
+		s.b2cV3[originatorID] = conversationID
+	}
+	var result asyncResult
+	if s.balance < amount {
+		result = failedResult(types.ResultCodeInsufficientFunds, "")
+	} else {
+		s.balance -= amount
+		tx := &Transaction{
+			ID:                       s.nextReceipt(),
+			Type:                     body["CommandID"],
+			Time:                     time.Now().In(utils.Nairobi),
+			Amount:                   amount,
+			ShortCode:                body["PartyA"],
+			MSISDN:                   body["PartyB"],
+			ConversationID:           conversationID,
+			OriginatorConversationID: originatorID,
+		}
+		s.record(tx)
+		balance := s.balance.String()
+		result = asyncResult{
+			code: types.ResultCodeSuccess,
+			desc: "The service request is processed successfully.",
+			txID: tx.ID,
+			params: []param{
+				{"TransactionAmount", amount.String()},
+				{"TransactionReceipt", tx.ID},
+				{"B2CRecipientIsRegisteredCustomer", "Y"},
+				{"B2CChargesPaidAccountAvailableFunds", "0.00"},
+				{"ReceiverPartyPublicName", tx.MSISDN + " - John Doe"},
+				{"TransactionCompletedDateTime", tx.Time.Format("02.01.2006 15:04:05")},
+				{"B2CUtilityAccountAvailableFunds", balance},
+				{"B2CWorkingAccountAvailableFunds", balance},
+			},
+		}
+	}
+	payload := resultPayload(conversationID, originatorID, result)
+	s.deliver(body["ResultURL"], s.callbackDelay, func() interface{} { return payload })
+	accepted(w, conversationID, originatorID)
+}
+
+// handleB2B pays another business from the working account.
+func (s *Server) handleB2B(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if !checkAsync(w, body, "Initiator", "SenderIdentifierType", "RecieverIdentifierType", "Amount", "PartyA", "PartyB", "Remarks") {
+		return
+	}
+	for _, field := range []string{"SenderIdentifierType", "RecieverIdentifierType", "PartyA", "PartyB"} {
+		if !numeric(body[field]) {
+			invalid(w, field)
+			return
+		}
+	}
+	receiverType := map[string]string{
+		"BusinessPayBill":  types.IdentifierShortCode,
+		"BusinessBuyGoods": types.IdentifierTillNumber,
+		"PayTaxToKRA":      types.IdentifierShortCode,
+	}[body["CommandID"]]
+	switch {
+	case body["SenderIdentifierType"] != types.IdentifierShortCode:
+		invalid(w, "SenderIdentifierType")
+		return
+	case receiverType != "" && body["RecieverIdentifierType"] != receiverType:
+		invalid(w, "RecieverIdentifierType")
+		return
+	case body["CommandID"] == "BusinessPayBill" && body["AccountReference"] == "":
+		invalid(w, "AccountReference")
+		return
+	}
+	amount, ok := wholeAmount(body["Amount"], 1, 0)
+	if !ok {
+		invalid(w, "Amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversationID, originatorID := s.conversationIDs()
+	var result asyncResult
+	if s.balance < amount {
+		result = failedResult(types.ResultCodeInsufficientFunds, "")
+	} else {
+		s.balance -= amount
+		tx := &Transaction{
+			ID:                       s.nextReceipt(),
+			Type:                     body["CommandID"],
+			Time:                     time.Now().In(utils.Nairobi),
+			Amount:                   amount,
+			ShortCode:                body["PartyA"],
+			BillReference:            body["AccountReference"],
+			ConversationID:           conversationID,
+			OriginatorConversationID: originatorID,
+		}
+		s.record(tx)
+		balance := "Working Account|KES|" + s.balance.String() + "|" + s.balance.String() + "|0.00|0.00"
+		result = asyncResult{
+			code: types.ResultCodeSuccess,
+			desc: "The service request is processed successfully.",
+			txID: tx.ID,
+			params: []param{
+				{"DebitAccountBalance", balance},
+				{"Amount", amount.String()},
+				{"DebitPartyAffectedAccountBalance", balance},
+				{"TransCompletedTime", utils.FormatTimestamp(tx.Time)},
+				{"DebitPartyCharges", ""},
+				{"ReceiverPartyPublicName", body["PartyB"] + " - Test Receiver"},
+				{"Currency", "KES"},
+				{"InitiatorAccountCurrentBalance", "{Amount={BasicAmount=" + s.balance.String() + ", MinimumAmount=" + strconv.FormatInt(s.balance.Cents(), 10) + ", CurrencyCode=KES}}"},
+			},
+		}
+	}
+	payload := resultPayload(conversationID, originatorID, result)
+	s.deliver(body["ResultURL"], s.callbackDelay, func() interface{} { return payload })
+	accepted(w, conversationID, originatorID)
+}
+
+// handleRemitTax pays tax to KRA with a B2B payment to its paybill.
+func (s *Server) handleRemitTax(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	switch {
+	case body["CommandID"] != "PayTaxToKRA":
+		invalid(w, "CommandID")
+		return
+	case body["PartyB"] != types.KRAShortCode:
+		invalid(w, "PartyB")
+		return
+	case body["AccountReference"] == "":
+		invalid(w, "AccountReference")
+		return
+	}
+	s.handleB2B(w, r, body)
+}
+
+// handleB2BExpressCheckout pushes a payment prompt to a till operator, who
+// always accepts it.
+func (s *Server) handleB2BExpressCheckout(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "primaryShortCode", "receiverShortCode", "amount", "paymentRef", "callbackUrl", "partnerName", "RequestRefID"); field != "" {
+		invalid(w, field)
+		return
+	}
+	for _, field := range []string{"primaryShortCode", "receiverShortCode"} {
+		if !numeric(body[field]) {
+			invalid(w, field)
+			return
+		}
+	}
+	if !validURL(body["callbackUrl"]) {
+		invalid(w, "callbackUrl")
+		return
+	}
+	amount, ok := wholeAmount(body["amount"], 1, 0)
+	if !ok {
+		invalid(w, "amount")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	conversationID, _ := s.conversationIDs()
+	tx := &Transaction{
+		ID:             s.nextReceipt(),
+		Type:           "BusinessBuyGoods",
+		Time:           time.Now().In(utils.Nairobi),
+		Amount:         amount,
+		ShortCode:      body["receiverShortCode"],
+		BillReference:  body["paymentRef"],
+		Sender:         body["primaryShortCode"],
+		ConversationID: conversationID,
+	}
+	s.record(tx)
+	payload := map[string]string{
+		"resultCode":     types.ResultCodeSuccess,
+		"resultDesc":     "The service request is processed successfully.",
+		"amount":         amount.String(),
+		"requestId":      body["RequestRefID"],
+		"resultType":     "0",
+		"conversationID": conversationID,
+		"transactionId":  tx.ID,
+		"status":         "SUCCESS",
+	}
+	s.deliver(body["callbackUrl"], s.callbackDelay, func() interface{} { return payload })
+	writeJSON(w, http.StatusOK, map[string]string{"code": "0", "status": "USSD Initiated Successfully"})
+}
+
+// maxQRSize caps the QR image size so a request cannot make the fake server
+// allocate a huge image.
+const maxQRSize = 1000
+
+// handleQRCode generates a dynamic QR code. The image is a blank PNG of the
+// requested size standing in for the QR code Daraja draws.
+func (s *Server) handleQRCode(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "MerchantName", "RefNo", "Amount", "TrxCode", "CPI", "Size"); field != "" {
+		invalid(w, field)
+		return
+	}
+	switch body["TrxCode"] {
+	case "BG", "WA", "PB", "SM", "SB":
+	default:
+		invalid(w, "TrxCode")
+		return
+	}
+	if _, ok := wholeAmount(body["Amount"], 1, 0); !ok {
+		invalid(w, "Amount")
+		return
+	}
+	size, err := strconv.Atoi(body["Size"])
+	if err != nil || size <= 0 || size > maxQRSize {
+		invalid(w, "Size")
+		return
+	}
+
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		writeError(w, http.StatusInternalServerError, "500.003.02", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ResponseCode":        "AG_" + s.nextID(time.Now().In(utils.Nairobi).Format("20060102_")),
+		"RequestID":           s.nextID("16738-27456357-"),
+		"ResponseDescription": "QR Code Successfully Generated.",
+		"QRCode":              base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+}
+
+// handlePullRegister registers a shortcode for the Pull API.
+func (s *Server) handlePullRegister(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "ShortCode", "NominatedNumber", "CallBackURL"); field != "" {
+		invalid(w, field)
+		return
+	}
+	switch {
+	case !numeric(body["ShortCode"]):
+		invalid(w, "ShortCode")
+		return
+	case !phone.Valid(body["NominatedNumber"]):
+		invalid(w, "NominatedNumber")
+		return
+	case !validURL(body["CallBackURL"]):
+		invalid(w, "CallBackURL")
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pull[body["ShortCode"]] = body["CallBackURL"]
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ResponseRefID":       s.nextID("pull-"),
+		"ResponseStatus":      "1000",
+		"ShortCode":           body["ShortCode"],
+		"ResponseDescription": "Shortcode Registered Successfully",
+	})
+}
+
+// pullDateLayouts are the date formats accepted by the Pull API query.
+var pullDateLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// parsePullDate parses a Pull API date in Nairobi time.
+func parsePullDate(s string) (time.Time, bool) {
+	for _, layout := range pullDateLayouts {
+		if t, err := time.ParseInLocation(layout, s, utils.Nairobi); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// handlePullQuery returns a page of the customer payments to a registered shortcode.
+func (s *Server) handlePullQuery(w http.ResponseWriter, r *http.Request, body map[string]string) {
+	if field := missing(body, "ShortCode", "StartDate", "EndDate", "OffSetValue"); field != "" {
+		invalid(w, field)
+		return
+	}
+	start, ok := parsePullDate(body["StartDate"])
+	if !ok {
+		invalid(w, "StartDate")
+		return
+	}
+	end, ok := parsePullDate(body["EndDate"])
+	if !ok || end.Before(start) {
+		invalid(w, "EndDate")
+		return
+	}
+	if len(body["EndDate"]) == len("2006-01-02") {
+		end = end.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	offset, err := strconv.Atoi(body["OffSetValue"])
+	if err != nil || offset < 0 {
+		invalid(w, "OffSetValue")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pull[body["ShortCode"]]; !ok {
+		writeError(w, http.StatusBadRequest, "400.002.02", "Bad Request - Invalid ShortCode: not registered for Pull API")
+		return
+	}
+	var matched []*Transaction
+	for _, tx := range s.transactions {
+		switch tx.Type {
+		case "CustomerPayBillOnline", "CustomerBuyGoodsOnline":
+		default:
+			continue
+		}
+		if tx.ShortCode == body["ShortCode"] && !tx.Time.Before(start) && !tx.Time.After(end) {
+			matched = append(matched, tx)
+		}
+	}
+	page := []map[string]interface{}{}
+	for i := offset; i < len(matched) && len(page) < s.pullPageSize; i++ {
+		tx := matched[i]
+		msisdn, _ := strconv.ParseInt(tx.MSISDN, 10, 64)
+		transactionType := "c2b-pay-bill-debit"
+		if tx.Type == "CustomerBuyGoodsOnline" {
+			transactionType = "c2b-buy-goods-debit"
+		}
+		page = append(page, map[string]interface{}{
+			"transactionId":    tx.ID,
+			"trxDate":          tx.Time.Format("2006-01-02T15:04:05Z"),
+			"msisdn":           msisdn,
+			"sender":           "MPESA",
+			"transactiontype":  transactionType,
+			"billreference":    tx.BillReference,
+			"amount":           tx.Amount.String(),
+			"organizationname": "Test Shop",
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ResponseRefID":   s.nextID("pull-"),
+		"ResponseCode":    "1000",
+		"ResponseMessage": "Success",
+		"Response":        page,
+	})
+}
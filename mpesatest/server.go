@@ -0,0 +1,417 @@
+// Package mpesatest provides a fake Daraja server for running M-Pesa payment
+// flows offline. It implements every endpoint supported by client.Mpesa,
+// validates requests the way Daraja does, keeps track of the transactions it
+// processed, and delivers STK, C2B and result callbacks to the URLs given in
+// the requests.
+//
+//	srv := mpesatest.NewServer()
+//	defer srv.Close()
+//	mpesa := srv.Client()
+package mpesatest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// Credentials and shortcodes accepted by the fake server by default.
+const (
+	ConsumerKey    = "test-consumer-key"
+	ConsumerSecret = "test-consumer-secret"
+	// ShortCode and Passkey are the public Daraja sandbox Lipa Na M-Pesa credentials.
+	ShortCode = "174379"
+	Passkey   = "bfb279f9aa9bdbcf158e97dd71a467cd2e0c893059b10f78e6b72ada1ed2c919"
+)
+
+// Endpoint paths served by the fake server.
+const (
+	PathOAuth            = "/oauth/v1/generate"
+	PathSTKPush          = "/mpesa/stkpush/v1/processrequest"
+	PathSTKPushQuery     = "/mpesa/stkpushquery/v1/query"
+	PathRegisterURL      = "/mpesa/c2b/v2/registerurl"
+	PathSimulate         = "/mpesa/c2b/v1/simulate"
+	PathReversal         = "/mpesa/reversal/v1/request"
+	PathTransactionQuery = "/mpesa/transactionstatus/v1/query"
+	PathBalance          = "/mpesa/accountbalance/v1/query"
+	PathB2C              = "/mpesa/b2c/v1/paymentrequest"
+	PathB2CV3            = "/mpesa/b2c/v3/paymentrequest"
+	PathB2B              = "/mpesa/b2b/v1/paymentrequest"
+	PathRemitTax         = "/mpesa/b2b/v1/remittax"
+	PathB2BExpress       = "/v1/ussdpush/get-msisdn"
+	PathQRCode           = "/mpesa/qrcode/v1/generate"
+	PathPullRegister     = "/pulltransactions/v1/register"
+	PathPullQuery        = "/pulltransactions/v1/query"
+)
+
+// Result codes the fake server reports for status queries and reversals that
+// cannot be carried out.
+const (
+	ResultCodeTransactionNotFound = "R000001"
+	ResultCodeAlreadyReversed     = "R000002"
+)
+
+// Failure makes requests to an endpoint fail instead of being processed.
+type Failure struct {
+	Status       int
+	ErrorCode    string
+	ErrorMessage string
+	// RetryAfter, if set, is sent as the Retry-After header.
+	RetryAfter string
+	// Times is how many requests fail; zero or less fails until ClearFailures.
+	Times int
+}
+
+// Transaction is a completed transaction recorded by the fake server.
+type Transaction struct {
+	ID            string
+	Type          string
+	Time          time.Time
+	Amount        types.Amount
+	ShortCode     string
+	MSISDN        string
+	BillReference string
+	Sender        string
+	Reversed      bool
+	// ConversationID and OriginatorConversationID identify the request that
+	// created the transaction, if it was not a customer payment.
+	ConversationID           string
+	OriginatorConversationID string
+}
+
+// stkRequest is an STK Push waiting for, or holding, its final result.
+type stkRequest struct {
+	merchantRequestID string
+	checkoutRequestID string
+	resultCode        string
+	done              bool
+}
+
+// c2bURLs are the validation and confirmation URLs registered for a shortcode.
+type c2bURLs struct {
+	validation   string
+	confirmation string
+	responseType string
+}
+
+// Server is a fake Daraja API. Create one with NewServer.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:1234.
+	URL string
+
+	srv        *httptest.Server
+	httpClient *http.Client
+	deliveries sync.WaitGroup
+
+	mu            sync.Mutex
+	seq           int
+	tokens        map[string]time.Time
+	passkeys      map[string]string
+	failures      map[string]*Failure
+	stkResults    map[string]string
+	callbackDelay time.Duration
+	stk           map[string]*stkRequest
+	c2b           map[string]c2bURLs
+	pull          map[string]string
+	pullPageSize  int
+	balance       types.Amount
+	transactions  []*Transaction
+	// b2cV3 maps the OriginatorConversationID of every v3 B2C payment to its ConversationID.
+	b2cV3 map[string]string
+}
+
+// NewServer starts a fake Daraja server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		tokens:       make(map[string]time.Time),
+		passkeys:     map[string]string{ShortCode: Passkey},
+		failures:     make(map[string]*Failure),
+		stkResults:   make(map[string]string),
+		stk:          make(map[string]*stkRequest),
+		c2b:          make(map[string]c2bURLs),
+		pull:         make(map[string]string),
+		b2cV3:        make(map[string]string),
+		balance:      100000000,
+		pullPageSize: 1000,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PathOAuth, s.handleOAuth)
+	for path, handler := range map[string]func(http.ResponseWriter, *http.Request, map[string]string){
+		PathSTKPush:          s.handleSTKPush,
+		PathSTKPushQuery:     s.handleSTKPushQuery,
+		PathRegisterURL:      s.handleRegisterURL,
+		PathSimulate:         s.handleSimulate,
+		PathReversal:         s.handleReversal,
+		PathTransactionQuery: s.handleTransactionQuery,
+		PathBalance:          s.handleBalance,
+		PathB2C:              s.handleB2C,
+		PathB2CV3:            s.handleB2CV3,
+		PathB2B:              s.handleB2B,
+		PathRemitTax:         s.handleRemitTax,
+		PathB2BExpress:       s.handleB2BExpressCheckout,
+		PathQRCode:           s.handleQRCode,
+		PathPullRegister:     s.handlePullRegister,
+		PathPullQuery:        s.handlePullQuery,
+	} {
+		mux.Handle("POST "+path, s.authorized(handler))
+	}
+	s.srv = httptest.NewServer(s.injectFailures(mux))
+	s.URL = s.srv.URL
+	return s
+}
+
+// Close waits for pending callback deliveries and shuts the server down.
+func (s *Server) Close() {
+	s.deliveries.Wait()
+	s.srv.Close()
+}
+
+// Wait blocks until all callbacks scheduled so far have been delivered.
+func (s *Server) Wait() {
+	s.deliveries.Wait()
+}
+
+// Client returns a client configured for the server with its default
+// credentials and sandbox passkey. Extra options are applied last.
+func (s *Server) Client(opts ...client.Option) *client.Mpesa {
+	opts = append([]client.Option{
+		client.WithBaseURL(s.URL),
+		client.WithCredentials(ConsumerKey, ConsumerSecret),
+		client.WithPasskey(ShortCode, Passkey),
+	}, opts...)
+	return client.NewMpesa(opts...)
+}
+
+// SetPasskey registers the passkey the server verifies STK passwords against
+// for shortCode. STK requests for shortcodes without a passkey are accepted
+// with any password.
+func (s *Server) SetPasskey(shortCode, passkey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.passkeys[shortCode] = passkey
+}
+
+// SetSTKResult sets the result code of STK Pushes to phone, e.g.
+// types.ResultCodeCancelledByUser. An empty phone sets the default for all
+// numbers, which is types.ResultCodeSuccess.
+func (s *Server) SetSTKResult(phone, resultCode string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stkResults[phone] = resultCode
+}
+
+// SetCallbackDelay sets how long after a request its callback is delivered.
+// STK Push queries report the transaction as being processed until then.
+func (s *Server) SetCallbackDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callbackDelay = delay
+}
+
+// SetBalance sets the working account balance used by B2C, B2B and balance queries.
+func (s *Server) SetBalance(balance types.Amount) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.balance = balance
+}
+
+// SetPullPageSize sets how many transactions a Pull API query returns at most.
+func (s *Server) SetPullPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pullPageSize = n
+}
+
+// Fail injects a failure for requests to path, one of the Path constants.
+func (s *Server) Fail(path string, failure Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[path] = &failure
+}
+
+// ClearFailures removes all injected failures.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = make(map[string]*Failure)
+}
+
+// Transactions returns a copy of the transactions completed so far.
+func (s *Server) Transactions() []Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Transaction, len(s.transactions))
+	for i, tx := range s.transactions {
+		out[i] = *tx
+	}
+	return out
+}
+
+// injectFailures answers requests with an injected failure, if any.
+func (s *Server) injectFailures(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		failure, ok := s.failures[r.URL.Path]
+		var f Failure
+		if ok {
+			f = *failure
+			if failure.Times > 0 {
+				if failure.Times--; failure.Times == 0 {
+					delete(s.failures, r.URL.Path)
+				}
+			}
+		}
+		s.mu.Unlock()
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if f.RetryAfter != "" {
+			w.Header().Set("Retry-After", f.RetryAfter)
+		}
+		writeError(w, f.Status, f.ErrorCode, f.ErrorMessage)
+	})
+}
+
+// authorized checks the bearer token and decodes the JSON body of a request.
+func (s *Server) authorized(handler func(http.ResponseWriter, *http.Request, map[string]string)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		s.mu.Lock()
+		expiry, ok := s.tokens[token]
+		s.mu.Unlock()
+		if !ok || time.Now().After(expiry) {
+			writeError(w, http.StatusUnauthorized, "404.001.03", "Invalid Access Token")
+			return
+		}
+		var raw map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			writeError(w, http.StatusBadRequest, "400.002.05", "Invalid Request Payload")
+			return
+		}
+		body := make(map[string]string, len(raw))
+		for k, v := range raw {
+			switch v := v.(type) {
+			case string:
+				body[k] = v
+			case float64:
+				body[k] = strconv.FormatFloat(v, 'f', -1, 64)
+			case nil:
+			default:
+				body[k] = fmt.Sprint(v)
+			}
+		}
+		handler(w, r, body)
+	})
+}
+
+// handleOAuth issues access tokens for the configured consumer credentials.
+func (s *Server) handleOAuth(w http.ResponseWriter, r *http.Request) {
+	key, secret, ok := r.BasicAuth()
+	if !ok || key != ConsumerKey || secret != ConsumerSecret {
+		writeError(w, http.StatusBadRequest, "400.008.01", "Invalid Authentication passed")
+		return
+	}
+	if r.URL.Query().Get("grant_type") != "client_credentials" {
+		writeError(w, http.StatusBadRequest, "400.008.02", "Invalid grant type passed")
+		return
+	}
+	s.mu.Lock()
+	token := "fake-" + s.nextID("token")
+	s.tokens[token] = time.Now().Add(time.Hour)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]string{"access_token": token, "expires_in": "3599"})
+}
+
+// nextID returns a unique identifier with the given prefix. s.mu must be held.
+func (s *Server) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("%s%06d", prefix, s.seq)
+}
+
+// nextReceipt returns a unique 10 character M-Pesa style receipt. s.mu must be held.
+func (s *Server) nextReceipt() string {
+	s.seq++
+	return "SIM" + strings.ToUpper(fmt.Sprintf("%07s", strconv.FormatInt(int64(s.seq), 36)))
+}
+
+// conversationIDs returns a new ConversationID and OriginatorConversationID. s.mu must be held.
+func (s *Server) conversationIDs() (string, string) {
+	s.seq++
+	return fmt.Sprintf("AG_%s_%016x", time.Now().Format("20060102"), s.seq), fmt.Sprintf("%05d-%07d-1", s.seq%100000, s.seq)
+}
+
+// deliver POSTs the value returned by payload to url in the background after
+// delay. payload runs just before delivery, so it can complete the transaction
+// the callback reports.
+func (s *Server) deliver(url string, delay time.Duration, payload func() interface{}) {
+	s.deliveries.Add(1)
+	go func() {
+		defer s.deliveries.Done()
+		time.Sleep(delay)
+		body, err := json.Marshal(payload())
+		if err != nil || url == "" {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.httpClient.Timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if resp, err := s.httpClient.Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+}
+
+// post synchronously POSTs payload to url and decodes the JSON response into out.
+func (s *Server) post(url string, payload, out interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// stkPassword returns the password Daraja expects for the given values.
+func stkPassword(shortCode, passkey, timestamp string) string {
+	return base64.StdEncoding.EncodeToString([]byte(shortCode + passkey + timestamp))
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a Daraja error response.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]string{
+		"requestId":    strconv.FormatInt(time.Now().UnixNano()%1e9, 10) + "-1",
+		"errorCode":    code,
+		"errorMessage": message,
+	})
+}
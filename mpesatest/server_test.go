@@ -0,0 +1,651 @@
+// Package mpesatest_test contains end-to-end tests of the client against the fake Daraja server.
+package mpesatest_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/callback"
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/mpesatest"
+	"github.com/freelancer254/mpesa-go/types"
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// receiver starts a server that receives callbacks on the given handlers.
+func receiver(t *testing.T, handlers map[string]http.Handler) string {
+	mux := http.NewServeMux()
+	for path, handler := range handlers {
+		mux.Handle(path, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// receive waits for a value sent to ch.
+func receive[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for callback")
+	}
+	var zero T
+	return zero
+}
+
+// stkRequest returns an STK Push to the sandbox shortcode.
+func stkRequest(callbackURL string) types.STKPushRequest {
+	return types.STKPushRequest{
+		BusinessShortCode: mpesatest.ShortCode,
+		Amount:            100 * types.Shilling,
+		PartyA:            "254708374149",
+		PartyB:            mpesatest.ShortCode,
+		PhoneNumber:       "254708374149",
+		CallBackURL:       callbackURL,
+		AccountReference:  "INV-001",
+		TransactionDesc:   "Payment",
+	}
+}
+
+// TestSTKPush_PayAndWait tests an STK Push completed through its callback.
+func TestSTKPush_PayAndWait(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetCallbackDelay(20 * time.Millisecond)
+
+	callbacks := client.NewSTKCallbacks()
+	url := receiver(t, map[string]http.Handler{"/stk": callback.STKPushHandler(callbacks.Deliver)})
+
+	outcome, err := srv.Client().PayAndWait(context.Background(), stkRequest(url+"/stk"), &client.PayAndWaitOptions{
+		Callbacks:        callbacks,
+		InitialPollDelay: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if outcome.Status != types.STKSucceeded || outcome.Callback == nil {
+		t.Fatalf("unexpected outcome %+v", outcome)
+	}
+	if outcome.Callback.Amount != 100*types.Shilling || outcome.Callback.PhoneNumber != "254708374149" || outcome.Callback.TransactionDate.IsZero() {
+		t.Errorf("unexpected callback %+v", outcome.Callback)
+	}
+
+	transactions := srv.Transactions()
+	if len(transactions) != 1 || transactions[0].ID != outcome.Callback.MpesaReceiptNumber || transactions[0].Amount != 10000 {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+}
+
+// TestSTKPushQuery_Processing tests that queries report the push as processing until the result is known.
+func TestSTKPushQuery_Processing(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetSTKResult("254708374149", types.ResultCodeCancelledByUser)
+	srv.SetCallbackDelay(50 * time.Millisecond)
+
+	mpesa := srv.Client()
+	resp, err := mpesa.STKPush(context.Background(), stkRequest("https://example.com/stk"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	query := types.STKPushQueryRequest{BusinessShortCode: mpesatest.ShortCode, CheckoutRequestID: resp.CheckoutRequestID}
+	if _, err := mpesa.STKPushQuery(context.Background(), query); !errors.Is(err, types.ErrTransactionProcessing) {
+		t.Fatalf("expected ErrTransactionProcessing, got %v", err)
+	}
+	srv.Wait()
+	result, err := mpesa.STKPushQuery(context.Background(), query)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result.ResultCode != types.ResultCodeCancelledByUser {
+		t.Errorf("expected result code 1032, got %q", result.ResultCode)
+	}
+	if len(srv.Transactions()) != 0 {
+		t.Error("expected no transaction for a cancelled push")
+	}
+}
+
+// TestSTKPush_Validation tests that invalid STK Pushes are rejected like Daraja does.
+func TestSTKPush_Validation(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	mpesa := srv.Client()
+
+	password, _ := utils.STKPassword(mpesatest.ShortCode, "wrong-passkey", time.Now())
+	wrongPassword := stkRequest("https://example.com/stk")
+	wrongPassword.Password, wrongPassword.Timestamp = password, utils.GetTimestamp()
+	var apiErr *types.APIError
+	if _, err := mpesa.STKPush(context.Background(), wrongPassword); !errors.As(err, &apiErr) {
+		t.Errorf("wrong password: expected APIError, got %v", err)
+	}
+
+	// The client rejects these itself, so post them directly.
+	token, err := mpesa.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, timestamp := utils.STKPassword(mpesatest.ShortCode, mpesatest.Passkey, time.Now())
+	for field, value := range map[string]interface{}{"Amount": 250001, "PhoneNumber": "0708374149"} {
+		body := map[string]interface{}{
+			"BusinessShortCode": mpesatest.ShortCode, "Password": password, "Timestamp": timestamp,
+			"TransactionType": "CustomerPayBillOnline", "Amount": 10, "PartyA": "254708374149",
+			"PartyB": mpesatest.ShortCode, "PhoneNumber": "254708374149", "CallBackURL": "https://example.com/stk",
+			"AccountReference": "INV-1", "TransactionDesc": "Payment",
+		}
+		body[field] = value
+		data, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+mpesatest.PathSTKPush, bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", field, resp.StatusCode)
+		}
+	}
+}
+
+// TestC2B_Simulate tests that simulated payments go through validation and confirmation.
+func TestC2B_Simulate(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	confirmed := make(chan *types.C2BTransaction, 2)
+	url := receiver(t, map[string]http.Handler{
+		"/validate": callback.C2BValidationHandler(func(ctx context.Context, tx *types.C2BTransaction) error {
+			if tx.BillRefNumber != "ACC-1" {
+				return callback.Reject(types.C2BInvalidAccountNumber)
+			}
+			return nil
+		}),
+		"/confirm": callback.C2BConfirmationHandler(func(ctx context.Context, tx *types.C2BTransaction) error {
+			confirmed <- tx
+			return nil
+		}),
+	})
+
+	mpesa := srv.Client()
+	_, err := mpesa.RegisterURL(context.Background(), types.RegisterURLRequest{
+		ShortCode:       "600000",
+		ResponseType:    "Completed",
+		ConfirmationURL: url + "/confirm",
+		ValidationURL:   url + "/validate",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, account := range []string{"ACC-2", "ACC-1"} {
+		_, err := mpesa.SimulateTransaction(context.Background(), types.SimulateTransactionRequest{
+			ShortCode:     "600000",
+			Amount:        250 * types.Shilling,
+			Msisdn:        "254708374149",
+			BillRefNumber: account,
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+	srv.Wait()
+
+	tx := receive(t, confirmed)
+	if tx.BillRefNumber != "ACC-1" || tx.TransAmount != 250*types.Shilling || tx.BusinessShortCode != "600000" {
+		t.Errorf("unexpected confirmation %+v", tx)
+	}
+	if len(confirmed) != 0 {
+		t.Error("expected the rejected payment not to be confirmed")
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 || transactions[0].ID != tx.TransID {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+}
+
+// b2cRequest returns a B2C payment with results delivered to url.
+func b2cRequest(url string, amount types.Amount) types.B2CSendRequest {
+	return types.B2CSendRequest{
+		InitiatorName:      "testapi",
+		SecurityCredential: "credential",
+		CommandID:          "BusinessPayment",
+		Amount:             amount,
+		PartyA:             "600000",
+		PartyB:             "254708374149",
+		Remarks:            "Payout",
+		QueueTimeOutURL:    url + "/timeout",
+		ResultURL:          url + "/b2c",
+		Occasion:           "Test",
+	}
+}
+
+// TestB2C_Result tests that B2C results are delivered and debit the balance.
+func TestB2C_Result(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(50000)
+
+	results := make(chan *types.B2CResult, 2)
+	url := receiver(t, map[string]http.Handler{
+		"/b2c": callback.B2CResultHandler(func(ctx context.Context, result *types.B2CResult) error {
+			results <- result
+			return nil
+		}),
+	})
+
+	mpesa := srv.Client()
+	resp, err := mpesa.B2CSend(context.Background(), b2cRequest(url, 300*types.Shilling))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result := receive(t, results)
+	if !result.Success() || result.ConversationID != resp.ConversationID || result.TransactionAmount != 300*types.Shilling {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if result.B2CWorkingAccountAvailableFunds != 200*types.Shilling || result.TransactionCompletedDateTime.IsZero() {
+		t.Errorf("unexpected result parameters %+v", result)
+	}
+
+	if _, err := mpesa.B2CSend(context.Background(), b2cRequest(url, 300*types.Shilling)); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result := receive(t, results); result.ResultCode != types.ResultCodeInsufficientFunds {
+		t.Errorf("expected insufficient funds, got %+v", result)
+	}
+
+	if _, err := mpesa.B2CSend(context.Background(), b2cRequest(url, 5*types.Shilling)); err == nil {
+		t.Error("expected an error for an amount below the B2C minimum")
+	}
+}
+
+// TestB2C_V3 tests that v3 payments are identified, and deduplicated, by the caller's OriginatorConversationID.
+func TestB2C_V3(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	results := make(chan *types.B2CResult, 1)
+	url := receiver(t, map[string]http.Handler{
+		"/b2c": callback.B2CResultHandler(func(ctx context.Context, result *types.B2CResult) error {
+			results <- result
+			return nil
+		}),
+	})
+
+	mpesa := srv.Client()
+	resp, err := mpesa.B2CPayment(context.Background(), b2cRequest(url, 300*types.Shilling).V3("payout-42"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.OriginatorConversationID != "payout-42" {
+		t.Errorf("expected the OriginatorConversationID to be echoed, got %+v", resp)
+	}
+	if result := receive(t, results); !result.Success() || result.OriginatorConversationID != "payout-42" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	again, err := mpesa.B2CPayment(context.Background(), b2cRequest(url, 300*types.Shilling).V3("payout-42"))
+	if err != nil || again.ConversationID != resp.ConversationID {
+		t.Errorf("expected the repeated payment to be acknowledged again, got %+v, %v", again, err)
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 {
+		t.Errorf("expected the repeated payment not to pay twice, got %+v", transactions)
+	}
+
+	payment := b2cRequest(url, 300*types.Shilling).V3("payout-43")
+	payment.CommandID = "SalaryAdvance"
+	if _, err := mpesa.B2CPayment(context.Background(), payment); err == nil {
+		t.Error("expected an error for an unknown CommandID")
+	}
+}
+
+// TestBusinessPayBill_BuyGoods tests that the fake server pays paybill and till payments and that
+// paybill payments need an account reference. The exact payloads are tested in the client package.
+func TestBusinessPayBill_BuyGoods(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	results := make(chan *types.B2BResult, 2)
+	url := receiver(t, map[string]http.Handler{
+		"/b2b": callback.B2BResultHandler(func(ctx context.Context, result *types.B2BResult) error {
+			results <- result
+			return nil
+		}),
+	})
+
+	mpesa := srv.Client()
+	payBill := types.BusinessPayBillRequest{
+		Initiator:          "testapi",
+		SecurityCredential: "credential",
+		Amount:             500 * types.Shilling,
+		PartyA:             "600000",
+		PartyB:             "888880",
+		AccountReference:   "ACC-12",
+		Remarks:            "Rent",
+		QueueTimeOutURL:    url + "/timeout",
+		ResultURL:          url + "/b2b",
+	}
+	if _, err := mpesa.BusinessPayBill(context.Background(), payBill); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result := receive(t, results)
+	if !result.Success() || result.ParseError != nil {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if balance := 999500 * types.Shilling; result.DebitAccountBalance != balance || result.InitiatorAccountCurrentBalance != balance {
+		t.Errorf("expected balances of %v, got %+v", balance, result)
+	}
+
+	_, err := mpesa.BusinessBuyGoods(context.Background(), types.BusinessBuyGoodsRequest{
+		Initiator:          "testapi",
+		SecurityCredential: "credential",
+		Amount:             200 * types.Shilling,
+		PartyA:             "600000",
+		PartyB:             "373132",
+		Remarks:            "Supplies",
+		QueueTimeOutURL:    url + "/timeout",
+		ResultURL:          url + "/b2b",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if result := receive(t, results); !result.Success() {
+		t.Errorf("unexpected result %+v", result)
+	}
+	transactions := srv.Transactions()
+	if len(transactions) != 2 || transactions[0].Type != "BusinessPayBill" || transactions[1].Type != "BusinessBuyGoods" {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+
+	payBill.AccountReference = ""
+	if _, err := mpesa.BusinessPayBill(context.Background(), payBill); err == nil {
+		t.Error("expected an error for a paybill payment without an account reference")
+	}
+}
+
+// TestRemitTax tests paying tax to KRA and decoding its result.
+func TestRemitTax(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	results := make(chan *types.RemitTaxResult, 1)
+	url := receiver(t, map[string]http.Handler{
+		"/tax": callback.B2BResultHandler(func(ctx context.Context, result *types.RemitTaxResult) error {
+			results <- result
+			return nil
+		}),
+	})
+
+	request := types.RemitTaxRequest{
+		Initiator:          "testapi",
+		SecurityCredential: "credential",
+		Amount:             2390 * types.Shilling,
+		PartyA:             "600000",
+		PRN:                "2024100012345678",
+		Remarks:            "PAYE October",
+		QueueTimeOutURL:    url + "/timeout",
+		ResultURL:          url + "/tax",
+	}
+	mpesa := srv.Client()
+	resp, err := mpesa.RemitTax(context.Background(), request)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	result := receive(t, results)
+	if !result.Success() || result.ConversationID != resp.ConversationID || result.Amount != 2390*types.Shilling {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 || transactions[0].Type != "PayTaxToKRA" || transactions[0].BillReference != request.PRN {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+
+	request.PRN = "INV-7"
+	if _, err := mpesa.RemitTax(context.Background(), request); err == nil {
+		t.Error("expected an error for an invalid PRN")
+	}
+}
+
+// TestB2BExpressCheckout tests that the till operator's payment is reported to the callback URL.
+func TestB2BExpressCheckout(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	callbacks := make(chan *types.B2BExpressCheckoutCallback, 1)
+	url := receiver(t, map[string]http.Handler{
+		"/ussd": callback.B2BExpressCheckoutHandler(func(ctx context.Context, cb *types.B2BExpressCheckoutCallback) error {
+			callbacks <- cb
+			return nil
+		}),
+	})
+
+	resp, err := srv.Client().B2BExpressCheckout(context.Background(), types.B2BExpressCheckoutRequest{
+		PrimaryShortCode:  "000001",
+		ReceiverShortCode: "000002",
+		Amount:            100 * types.Shilling,
+		PaymentRef:        "INV-7",
+		CallbackURL:       url + "/ussd",
+		PartnerName:       "Distributor",
+		RequestRefID:      "8b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if resp.Code != "0" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	cb := receive(t, callbacks)
+	if !cb.Success() || cb.RequestID != "8b1f2c3d-4e5f-6071-8293-a4b5c6d7e8f9" || cb.Amount != 100*types.Shilling {
+		t.Errorf("unexpected callback %+v", cb)
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 || transactions[0].ID != cb.TransactionID {
+		t.Errorf("unexpected transactions %+v", transactions)
+	}
+}
+
+// TestGenerateQRCode tests generating a QR code and decoding its image.
+func TestGenerateQRCode(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	request := types.QRCodeRequest{
+		MerchantName: "TEST SUPERMARKET",
+		RefNo:        "Invoice Test",
+		Amount:       1 * types.Shilling,
+		TrxCode:      types.QRBuyGoods,
+		CPI:          "373132",
+		Size:         "300",
+	}
+	resp, err := srv.Client().GenerateQRCode(context.Background(), request)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	data, err := resp.PNG()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected a PNG image, got %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 300 || size.Y != 300 {
+		t.Errorf("unexpected image size %v", size)
+	}
+
+	request.TrxCode = "XX"
+	if _, err := srv.Client().GenerateQRCode(context.Background(), request); err == nil {
+		t.Error("expected an invalid TrxCode to be rejected")
+	}
+	if _, err := (&types.QRCodeResponse{QRCode: "bm90IGEgcG5n"}).PNG(); err == nil {
+		t.Error("expected an error decoding an image that is not a PNG")
+	}
+}
+
+// TestReversal_Status tests reversing a payment and querying its status.
+func TestReversal_Status(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	callbacks := client.NewSTKCallbacks()
+	reversals := make(chan *types.ReversalResult, 2)
+	statuses := make(chan *types.TransactionStatusResult, 1)
+	url := receiver(t, map[string]http.Handler{
+		"/stk": callback.STKPushHandler(callbacks.Deliver),
+		"/reversal": callback.ReversalResultHandler(func(ctx context.Context, result *types.ReversalResult) error {
+			reversals <- result
+			return nil
+		}),
+		"/status": callback.TransactionStatusResultHandler(func(ctx context.Context, result *types.TransactionStatusResult) error {
+			statuses <- result
+			return nil
+		}),
+	})
+
+	mpesa := srv.Client()
+	outcome, err := mpesa.PayAndWait(context.Background(), stkRequest(url+"/stk"), &client.PayAndWaitOptions{Callbacks: callbacks})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	receipt := outcome.Callback.MpesaReceiptNumber
+
+	reversal := types.ReverseTransactionRequest{
+		Initiator:              "testapi",
+		SecurityCredential:     "credential",
+		TransactionID:          receipt,
+		Amount:                 100 * types.Shilling,
+		ReceiverParty:          mpesatest.ShortCode,
+		ReceiverIdentifierType: "11",
+		ResultURL:              url + "/reversal",
+		QueueTimeOutURL:        url + "/timeout",
+		Remarks:                "Refund",
+		Occasion:               "Test",
+	}
+	for _, want := range []string{types.ResultCodeSuccess, mpesatest.ResultCodeAlreadyReversed} {
+		if _, err := mpesa.ReverseTransaction(context.Background(), reversal); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if result := receive(t, reversals); result.ResultCode != want {
+			t.Errorf("expected result code %q, got %+v", want, result)
+		}
+	}
+
+	_, err = mpesa.QueryTransaction(context.Background(), types.QueryTransactionRequest{
+		Initiator:          "testapi",
+		SecurityCredential: "credential",
+		TransactionID:      receipt,
+		PartyA:             mpesatest.ShortCode,
+		IdentifierType:     "4",
+		ResultURL:          url + "/status",
+		QueueTimeOutURL:    url + "/timeout",
+		Remarks:            "Status",
+		Occasion:           "Test",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status := receive(t, statuses); status.ReceiptNo != receipt || status.TransactionStatus != "Reversed" || status.Amount != 100*types.Shilling {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+// TestBalance_Result tests that balance results carry the working account balance.
+func TestBalance_Result(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(12345)
+
+	results := make(chan *types.BalanceResult, 1)
+	url := receiver(t, map[string]http.Handler{
+		"/balance": callback.BalanceResultHandler(func(ctx context.Context, result *types.BalanceResult) error {
+			results <- result
+			return nil
+		}),
+	})
+
+	_, err := srv.Client().GetBalance(context.Background(), types.GetBalanceRequest{
+		Initiator:          "testapi",
+		SecurityCredential: "credential",
+		PartyA:             "600000",
+		IdentifierType:     "4",
+		Remarks:            "Balance",
+		QueueTimeOutURL:    url + "/timeout",
+		ResultURL:          url + "/balance",
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	account, ok := receive(t, results).Account("Working Account")
+	if !ok || account.Available != 12345 {
+		t.Errorf("unexpected working account %+v", account)
+	}
+}
+
+// TestFailureInjection tests that injected failures are returned and retried.
+func TestFailureInjection(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.Fail(mpesatest.PathPullRegister, mpesatest.Failure{
+		Status:       http.StatusServiceUnavailable,
+		ErrorCode:    "503.001.01",
+		ErrorMessage: "Service Unavailable",
+		RetryAfter:   "0",
+		Times:        1,
+	})
+
+	register := types.RegisterPullAPIRequest{ShortCode: "600000", NominatedNumber: "254708374149", CallBackURL: "https://example.com/pull"}
+	if _, err := srv.Client().RegisterPullAPI(context.Background(), register); !errors.Is(err, types.ErrServiceUnavailable) {
+		t.Fatalf("expected ErrServiceUnavailable, got %v", err)
+	}
+
+	srv.Fail(mpesatest.PathPullRegister, mpesatest.Failure{Status: http.StatusServiceUnavailable, RetryAfter: "0", Times: 1})
+	mpesa := srv.Client(client.WithRetryPolicy(client.DefaultRetryPolicy()))
+	if _, err := mpesa.RegisterPullAPI(context.Background(), register); err != nil {
+		t.Fatalf("expected the retry to succeed, got %v", err)
+	}
+}
+
+// TestPullTransactions tests that pulled transactions are paged by offset.
+func TestPullTransactions(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetPullPageSize(2)
+
+	callbacks := client.NewSTKCallbacks()
+	url := receiver(t, map[string]http.Handler{"/stk": callback.STKPushHandler(callbacks.Deliver)})
+	mpesa := srv.Client()
+	for range 3 {
+		if _, err := mpesa.PayAndWait(context.Background(), stkRequest(url+"/stk"), &client.PayAndWaitOptions{Callbacks: callbacks}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	register := types.RegisterPullAPIRequest{ShortCode: mpesatest.ShortCode, NominatedNumber: "254708374149", CallBackURL: "https://example.com/pull"}
+	if _, err := mpesa.RegisterPullAPI(context.Background(), register); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	today := time.Now().In(utils.Nairobi).Format("2006-01-02")
+	var pulled []types.Transaction
+	for _, offset := range []string{"0", "2"} {
+		resp, err := mpesa.PullTransactions(context.Background(), types.PullTransactionsRequest{
+			ShortCode:   mpesatest.ShortCode,
+			StartDate:   today,
+			EndDate:     today,
+			OffSetValue: offset,
+		})
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		pulled = append(pulled, resp.Transactions...)
+	}
+	if len(pulled) != 3 || pulled[0].TransactionID == pulled[2].TransactionID || pulled[0].Msisdn != "254708374149" {
+		t.Errorf("unexpected transactions %+v", pulled)
+	}
+}
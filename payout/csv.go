@@ -0,0 +1,141 @@
+package payout
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/phone"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// csvColumns are the columns read by ParseCSV; id, phone and amount are required.
+var csvColumns = []string{"id", "phone", "amount", "command_id", "remarks", "occasion"}
+
+// ParseCSV reads a batch from CSV with a header row naming the columns id,
+// phone and amount, and optionally command_id, remarks and occasion. Amounts
+// are in shillings, e.g. 1500 or 1500.00; phone numbers in any common Kenyan
+// format are normalized with phone.Normalize. Problems with individual rows
+// are reported together as a *ValidationError.
+func ParseCSV(r io.Reader) ([]Payment, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvColumns[:3] {
+		if _, ok := index[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", name)
+		}
+	}
+	column := func(row []string, name string) string {
+		if i, ok := index[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var payments []Payment
+	var invalid []RowError
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		amount, err := types.ParseAmount(column(row, "amount"))
+		if err != nil {
+			invalid = append(invalid, RowError{Row: len(payments) + 1, ID: column(row, "id"), Err: err})
+		}
+		number := column(row, "phone")
+		if normalized, err := phone.Normalize(number); err == nil {
+			number = normalized
+		}
+		payments = append(payments, Payment{
+			ID:          column(row, "id"),
+			PhoneNumber: number,
+			Amount:      amount,
+			CommandID:   column(row, "command_id"),
+			Remarks:     column(row, "remarks"),
+			Occasion:    column(row, "occasion"),
+		})
+	}
+	if len(invalid) > 0 {
+		return nil, &ValidationError{Rows: invalid}
+	}
+	return payments, nil
+}
+
+// Report is the outcome of a batch run.
+type Report struct {
+	BatchID string
+	// Records are the rows in batch order.
+	Records []Record
+	// Counts is the number of rows per status.
+	Counts map[Status]int
+	// Total is the sum of all rows; Paid the sum of succeeded rows.
+	Total types.Amount
+	Paid  types.Amount
+}
+
+// newReport summarizes the records of a batch.
+func newReport(batchID string, records []Record) *Report {
+	report := &Report{BatchID: batchID, Records: records, Counts: make(map[Status]int)}
+	for _, record := range records {
+		report.Counts[record.Status]++
+		report.Total += record.Payment.Amount
+		if record.Status == StatusSucceeded {
+			report.Paid += record.Payment.Amount
+		}
+	}
+	return report
+}
+
+// Complete reports whether every row reached a final status.
+func (r *Report) Complete() bool {
+	return r.Counts[StatusPending] == 0 && r.Counts[StatusAccepted] == 0
+}
+
+// Unreconciled returns the rows that were submitted without an
+// acknowledgement. Check their status before paying them again.
+func (r *Report) Unreconciled() []Record {
+	var records []Record
+	for _, record := range r.Records {
+		if record.Status == StatusPending && !record.SubmittedAt.IsZero() {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// WriteCSV writes one line per row with its acknowledgement and result.
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{
+		"id", "phone", "amount", "status", "conversation_id", "originator_conversation_id",
+		"result_code", "result_desc", "transaction_receipt", "completed_at", "error",
+	})
+	for _, record := range r.Records {
+		var completed string
+		if !record.CompletedAt.IsZero() {
+			completed = record.CompletedAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			record.Payment.ID, record.Payment.PhoneNumber, record.Payment.Amount.String(), string(record.Status),
+			record.ConversationID, record.OriginatorConversationID,
+			record.ResultCode, record.ResultDesc, record.TransactionReceipt, completed, record.Error,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,437 @@
+// Package payout pays many customers through B2C in one batch. Every row is
+// validated before anything is sent, rows are dispatched by a bounded pool of
+// workers under a rate limit, and the state of every row is recorded in a
+// Store so that running an interrupted batch again never pays a row twice.
+//
+//	engine := &payout.Engine{
+//		Client:     mpesa,
+//		Store:      store,
+//		Correlator: results, // mounted on the ResultURL and QueueTimeOutURL
+//		Template:   types.B2CSendRequest{InitiatorName: "api", SecurityCredential: cred, PartyA: "600000", ...},
+//	}
+//	report, err := engine.Run(ctx, "salaries-2024-06", payments)
+package payout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/correlator"
+	"github.com/freelancer254/mpesa-go/phone"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// B2C amount limits enforced when validating a batch.
+const (
+	MinAmount = 10 * types.Shilling
+	MaxAmount = 250000 * types.Shilling
+)
+
+// Defaults applied to a zero Engine.
+const (
+	DefaultConcurrency   = 4
+	DefaultResultTimeout = 10 * time.Minute
+)
+
+// Status is the state of a payout row.
+type Status string
+
+const (
+	// StatusPending rows have not been acknowledged by Daraja. A pending row
+	// with SubmittedAt set was sent, but whether Daraja accepted it is
+	// unknown; it is not sent again and must be reconciled, e.g. with a
+	// transaction status query.
+	StatusPending Status = "pending"
+	// StatusAccepted rows were acknowledged and await their result.
+	StatusAccepted Status = "accepted"
+	// StatusSucceeded rows were paid.
+	StatusSucceeded Status = "succeeded"
+	// StatusFailed rows were rejected by Daraja or failed in their result.
+	StatusFailed Status = "failed"
+	// StatusTimedOut rows were reported on the QueueTimeOutURL.
+	StatusTimedOut Status = "timed out"
+)
+
+// Final reports whether no further change is expected for the status.
+func (s Status) Final() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusTimedOut
+}
+
+// Payment is a row of a batch.
+type Payment struct {
+	// ID identifies the row within the batch and must be unique. The row is
+	// sent with the OriginatorConversationID "<batch ID>/<ID>", so it must not
+	// change between runs.
+	ID          string       `json:"id"`
+	PhoneNumber string       `json:"phone"`
+	Amount      types.Amount `json:"amount"`
+	// CommandID, Remarks and Occasion override the Engine template.
+	CommandID string `json:"command_id,omitempty"`
+	Remarks   string `json:"remarks,omitempty"`
+	Occasion  string `json:"occasion,omitempty"`
+}
+
+// Record is the state of a row. It combines the acknowledgement of the B2C
+// request with its asynchronous result.
+type Record struct {
+	Payment     Payment   `json:"payment"`
+	Status      Status    `json:"status"`
+	SubmittedAt time.Time `json:"submitted_at,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	// Error describes why the row failed or why its outcome is unknown.
+	Error string `json:"error,omitempty"`
+
+	ConversationID           string `json:"conversation_id,omitempty"`
+	OriginatorConversationID string `json:"originator_conversation_id,omitempty"`
+	ResponseCode             string `json:"response_code,omitempty"`
+	ResponseDescription      string `json:"response_description,omitempty"`
+
+	ResultCode              string    `json:"result_code,omitempty"`
+	ResultDesc              string    `json:"result_desc,omitempty"`
+	TransactionReceipt      string    `json:"transaction_receipt,omitempty"`
+	ReceiverPartyPublicName string    `json:"receiver_party_public_name,omitempty"`
+	CompletedAt             time.Time `json:"completed_at,omitempty"`
+}
+
+// RowError is a validation problem of a row.
+type RowError struct {
+	// Row is the 1-based position of the row in the batch.
+	Row int
+	ID  string
+	Err error
+}
+
+// Error implements the error interface.
+func (e RowError) Error() string {
+	return fmt.Sprintf("row %d (%s): %v", e.Row, e.ID, e.Err)
+}
+
+// ValidationError lists every invalid row of a batch.
+type ValidationError struct {
+	Rows []RowError
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Rows))
+	for i, row := range e.Rows {
+		msgs[i] = row.Error()
+	}
+	return fmt.Sprintf("invalid batch: %d invalid rows: %s", len(e.Rows), strings.Join(msgs, "; "))
+}
+
+// Validate checks every row of a batch and returns a *ValidationError listing
+// all invalid rows, or nil.
+func Validate(payments []Payment) error {
+	var rows []RowError
+	seen := make(map[string]bool, len(payments))
+	for i, p := range payments {
+		var err error
+		switch {
+		case strings.TrimSpace(p.ID) == "":
+			err = errors.New("missing ID")
+		case seen[p.ID]:
+			err = errors.New("duplicate ID")
+		case !phone.Valid(p.PhoneNumber):
+			err = fmt.Errorf("invalid phone number %q", p.PhoneNumber)
+		case !p.Amount.IsWhole():
+			err = fmt.Errorf("amount %s is not a whole number of shillings", p.Amount)
+		case p.Amount < MinAmount || p.Amount > MaxAmount:
+			err = fmt.Errorf("amount %s outside %s to %s", p.Amount, MinAmount, MaxAmount)
+		}
+		seen[p.ID] = true
+		if err != nil {
+			rows = append(rows, RowError{Row: i + 1, ID: p.ID, Err: err})
+		}
+	}
+	if len(rows) > 0 {
+		return &ValidationError{Rows: rows}
+	}
+	return nil
+}
+
+// Engine runs payout batches.
+type Engine struct {
+	// Client sends the rows as B2C v3 payments.
+	Client *client.Mpesa
+	// Store records the state of every row. It is required.
+	Store Store
+	// Correlator, if set, receives the results posted to the ResultURL and
+	// QueueTimeOutURL of the template; without it rows end as accepted.
+	Correlator *correlator.Correlator
+	// Template holds the fields shared by every row: InitiatorName,
+	// SecurityCredential, CommandID, PartyA, Remarks, Occasion, ResultURL
+	// and QueueTimeOutURL.
+	Template types.B2CSendRequest
+	// Concurrency is the number of requests in flight; zero means DefaultConcurrency.
+	Concurrency int
+	// Rate caps the requests sent per second; zero means no limit.
+	Rate float64
+	// ResultTimeout is how long to wait for outstanding results once every
+	// row has been sent; zero means DefaultResultTimeout. Rows still awaiting
+	// their result then are reported as accepted, and picked up by the next run.
+	ResultTimeout time.Duration
+}
+
+// Run pays the rows of a batch and returns the final report. Rows already
+// recorded for batchID in the store are not sent again: running a batch
+// again after a crash sends only the rows that were never submitted and
+// waits for the results of accepted rows.
+//
+// Run returns an error without sending anything when batchID is empty or
+// contains a "/", which separates it from the row ID in the
+// OriginatorConversationID, or when a row is invalid or differs from the row
+// recorded under the same ID.
+func (e *Engine) Run(ctx context.Context, batchID string, payments []Payment) (*Report, error) {
+	if e.Client == nil || e.Store == nil {
+		return nil, errors.New("payout engine needs a Client and a Store")
+	}
+	if batchID == "" || strings.Contains(batchID, "/") {
+		return nil, fmt.Errorf("invalid batch ID %q", batchID)
+	}
+	if err := Validate(payments); err != nil {
+		return nil, err
+	}
+	saved, err := e.Store.Load(ctx, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load batch %s: %w", batchID, err)
+	}
+	previous := make(map[string]Record, len(saved))
+	for _, record := range saved {
+		previous[record.Payment.ID] = record
+	}
+
+	for i, p := range payments {
+		if record, ok := previous[p.ID]; ok && record.Payment != p {
+			return nil, fmt.Errorf("row %d (%s) differs from the row recorded for batch %s", i+1, p.ID, batchID)
+		}
+	}
+	r := &run{engine: e, batchID: batchID, records: make([]Record, len(payments))}
+	for i, p := range payments {
+		record, ok := previous[p.ID]
+		if !ok {
+			record = Record{Payment: p, Status: StatusPending}
+			if err := r.save(ctx, i, record); err != nil {
+				return nil, err
+			}
+		}
+		r.records[i] = record
+	}
+
+	var limit *limiter
+	if e.Rate > 0 {
+		limit = &limiter{interval: time.Duration(float64(time.Second) / e.Rate)}
+	}
+	resultTimeout := e.ResultTimeout
+	if resultTimeout <= 0 {
+		resultTimeout = DefaultResultTimeout
+	}
+	resultCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var waits sync.WaitGroup
+	await := func(i int) {
+		if e.Correlator == nil {
+			return
+		}
+		waits.Add(1)
+		go func() {
+			defer waits.Done()
+			r.await(resultCtx, i)
+		}()
+	}
+
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	concurrency := e.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	for range concurrency {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range jobs {
+				if limit != nil && limit.wait(ctx) != nil {
+					continue
+				}
+				if r.send(ctx, i) {
+					await(i)
+				}
+			}
+		}()
+	}
+
+dispatch:
+	for i := range r.records {
+		record := r.get(i)
+		switch {
+		case record.Status == StatusAccepted:
+			await(i)
+		case record.Status == StatusPending && record.SubmittedAt.IsZero():
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+	}
+	close(jobs)
+	workers.Wait()
+	timer := time.AfterFunc(resultTimeout, cancel)
+	defer timer.Stop()
+	waits.Wait()
+
+	report := newReport(batchID, r.records)
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	return report, r.err
+}
+
+// run is the state of one Run call.
+type run struct {
+	engine  *Engine
+	batchID string
+
+	mu      sync.Mutex
+	records []Record
+	err     error
+}
+
+// get returns the current record of row i.
+func (r *run) get(i int) Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.records[i]
+}
+
+// save stores the record of row i in the store and in memory.
+func (r *run) save(ctx context.Context, i int, record Record) error {
+	record.UpdatedAt = time.Now()
+	err := r.engine.Store.Save(context.WithoutCancel(ctx), r.batchID, record)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[i] = record
+	if err != nil {
+		err = fmt.Errorf("failed to save row %s of batch %s: %w", record.Payment.ID, r.batchID, err)
+		if r.err == nil {
+			r.err = err
+		}
+	}
+	return err
+}
+
+// send submits row i and reports whether Daraja accepted it.
+func (r *run) send(ctx context.Context, i int) bool {
+	record := r.get(i)
+	// Mark the row as submitted before sending: should the process die
+	// before the acknowledgement is saved, the row is not sent again.
+	record.SubmittedAt = time.Now()
+	if r.save(ctx, i, record) != nil {
+		return false
+	}
+
+	payment, payload := record.Payment, r.engine.Template
+	payload.PartyB = payment.PhoneNumber
+	payload.Amount = payment.Amount
+	if payment.CommandID != "" {
+		payload.CommandID = payment.CommandID
+	}
+	if payment.Remarks != "" {
+		payload.Remarks = payment.Remarks
+	}
+	if payment.Occasion != "" {
+		payload.Occasion = payment.Occasion
+	}
+	// Daraja deduplicates the OriginatorConversationID, so the client may
+	// retry the request without paying the row twice.
+	ack, err := r.engine.Client.B2CPayment(ctx, payload.V3(r.batchID+"/"+payment.ID))
+
+	var apiErr *types.APIError
+	var invalid validator.ValidationErrors
+	switch {
+	case err == nil:
+		record.Status = StatusAccepted
+		record.ConversationID = ack.ConversationID
+		record.OriginatorConversationID = ack.OriginatorConversationID
+		record.ResponseCode = ack.ResponseCode
+		record.ResponseDescription = ack.ResponseDescription
+		record.Error = ""
+	case errors.As(err, &apiErr) || errors.As(err, &invalid):
+		// Daraja, or local validation, rejected the request: nothing was paid.
+		record.Status = StatusFailed
+		record.Error = err.Error()
+	default:
+		// The request may or may not have reached Daraja.
+		record.Error = "outcome unknown, reconcile before paying again: " + err.Error()
+	}
+	r.save(ctx, i, record)
+	return record.Status == StatusAccepted
+}
+
+// await waits for the result of accepted row i.
+func (r *run) await(ctx context.Context, i int) {
+	record := r.get(i)
+	outcome, err := r.engine.Correlator.Register(record.ConversationID, record.OriginatorConversationID).Wait(ctx)
+	if err != nil {
+		return
+	}
+	result := outcome.Result
+	record.ResultCode = result.ResultCode
+	record.ResultDesc = result.ResultDesc
+	switch {
+	case outcome.TimedOut:
+		record.Status = StatusTimedOut
+	case result.Success():
+		record.Status = StatusSucceeded
+		// Keep whatever parameters could be read.
+		b2c, _ := result.AsB2C()
+		record.TransactionReceipt = b2c.TransactionReceipt
+		record.ReceiverPartyPublicName = b2c.ReceiverPartyPublicName
+		record.CompletedAt = b2c.TransactionCompletedDateTime
+		if record.TransactionReceipt == "" {
+			record.TransactionReceipt = result.TransactionID
+		}
+	default:
+		record.Status = StatusFailed
+		record.Error = result.ResultDesc
+	}
+	r.save(ctx, i, record)
+}
+
+// limiter spaces out requests to a fixed rate.
+type limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the next request may be sent.
+func (l *limiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
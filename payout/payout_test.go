@@ -0,0 +1,326 @@
+// Package payout_test contains tests of the payout engine against the fake Daraja server.
+package payout_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/client"
+	"github.com/freelancer254/mpesa-go/correlator"
+	"github.com/freelancer254/mpesa-go/mpesatest"
+	"github.com/freelancer254/mpesa-go/payout"
+	"github.com/freelancer254/mpesa-go/types"
+)
+
+// newEngine returns an engine paying through srv, with results fed to a correlator.
+func newEngine(t *testing.T, srv *mpesatest.Server, store payout.Store) *payout.Engine {
+	results := correlator.New(nil, 10*time.Millisecond)
+	mux := http.NewServeMux()
+	mux.Handle("/result", results.ResultHandler())
+	mux.Handle("/timeout", results.TimeoutHandler())
+	receiver := httptest.NewServer(mux)
+	t.Cleanup(receiver.Close)
+
+	return &payout.Engine{
+		Client:     srv.Client(),
+		Store:      store,
+		Correlator: results,
+		Template: types.B2CSendRequest{
+			InitiatorName:      "testapi",
+			SecurityCredential: "credential",
+			CommandID:          "SalaryPayment",
+			PartyA:             "600000",
+			Remarks:            "Salary",
+			Occasion:           "June",
+			ResultURL:          receiver.URL + "/result",
+			QueueTimeOutURL:    receiver.URL + "/timeout",
+		},
+		Concurrency:   3,
+		Rate:          200,
+		ResultTimeout: 5 * time.Second,
+	}
+}
+
+const batchCSV = `id,phone,amount,remarks
+agent-1,254708374149,1000,
+agent-2,+254 711 000 001,2500.00,Bonus
+agent-3,254711000002,500,
+agent-4,254711000003,700,
+`
+
+// TestParseCSV tests reading a batch with optional columns.
+func TestParseCSV(t *testing.T) {
+	payments, err := payout.ParseCSV(strings.NewReader(batchCSV))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(payments) != 4 || payments[1].Amount != 250000 || payments[1].Remarks != "Bonus" || payments[1].PhoneNumber != "254711000001" || payments[0].PhoneNumber != "254708374149" {
+		t.Errorf("unexpected payments %+v", payments)
+	}
+
+	if _, err := payout.ParseCSV(strings.NewReader("id,phone\n1,254708374149\n")); err == nil {
+		t.Error("expected an error for a missing amount column")
+	}
+}
+
+// TestValidate tests that every invalid row is reported.
+func TestValidate(t *testing.T) {
+	err := payout.Validate([]payout.Payment{
+		{ID: "a", PhoneNumber: "254708374149", Amount: 100000},
+		{ID: "a", PhoneNumber: "254708374149", Amount: 100000},
+		{ID: "b", PhoneNumber: "0708374149", Amount: 100000},
+		{ID: "c", PhoneNumber: "254708374149", Amount: 500},
+		{ID: "d", PhoneNumber: "254708374149", Amount: 100050},
+	})
+	var invalid *payout.ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+	if len(invalid.Rows) != 4 || invalid.Rows[0].Row != 2 || invalid.Rows[3].ID != "d" {
+		t.Errorf("unexpected invalid rows %+v", invalid.Rows)
+	}
+}
+
+// TestEngine_Run tests that a batch is paid and reported with its results.
+func TestEngine_Run(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.SetBalance(400000)
+
+	payments, err := payout.ParseCSV(strings.NewReader(batchCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := newEngine(t, srv, payout.NewMemoryStore()).Run(context.Background(), "june", payments)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !report.Complete() || report.Counts[payout.StatusSucceeded]+report.Counts[payout.StatusFailed] != 4 {
+		t.Fatalf("unexpected counts %v", report.Counts)
+	}
+	// The balance falls 700 short of the batch, so whichever row overdraws it fails.
+	if report.Counts[payout.StatusFailed] != 1 || report.Total != 470000 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	for _, record := range report.Records {
+		if record.Status == payout.StatusSucceeded && (record.TransactionReceipt == "" || record.ConversationID == "") {
+			t.Errorf("expected receipt and conversation ID, got %+v", record)
+		}
+		if record.Status == payout.StatusFailed && record.ResultCode != types.ResultCodeInsufficientFunds {
+			t.Errorf("expected insufficient funds, got %+v", record)
+		}
+	}
+	if len(srv.Transactions()) != 3 {
+		t.Errorf("expected 3 payments, got %d", len(srv.Transactions()))
+	}
+
+	var out strings.Builder
+	if err := report.WriteCSV(&out); err != nil || !strings.Contains(out.String(), "agent-2,254711000001,2500.00") {
+		t.Errorf("unexpected CSV report %q (%v)", out.String(), err)
+	}
+}
+
+// TestEngine_Resume tests that a resumed batch only sends rows that were never submitted.
+func TestEngine_Resume(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	store, err := payout.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	payments := []payout.Payment{
+		{ID: "paid", PhoneNumber: "254708374149", Amount: 100000},
+		{ID: "unknown", PhoneNumber: "254711000001", Amount: 100000},
+		{ID: "fresh", PhoneNumber: "254711000002", Amount: 100000},
+	}
+	ctx := context.Background()
+	store.Save(ctx, "june", payout.Record{Payment: payments[0], Status: payout.StatusSucceeded, TransactionReceipt: "SIM0000001"})
+	store.Save(ctx, "june", payout.Record{Payment: payments[1], Status: payout.StatusPending, SubmittedAt: time.Now()})
+
+	report, err := newEngine(t, srv, store).Run(ctx, "june", payments)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 || transactions[0].MSISDN != "254711000002" {
+		t.Errorf("expected only the fresh row to be paid, got %+v", transactions)
+	}
+	if unreconciled := report.Unreconciled(); len(unreconciled) != 1 || unreconciled[0].Payment.ID != "unknown" {
+		t.Errorf("unexpected unreconciled rows %+v", unreconciled)
+	}
+	if report.Records[2].Status != payout.StatusSucceeded || report.Paid != 200000 {
+		t.Errorf("unexpected report %+v", report)
+	}
+
+	changed := append([]payout.Payment(nil), payments...)
+	changed[2].Amount = 200000
+	if _, err := newEngine(t, srv, store).Run(ctx, "june", changed); err == nil {
+		t.Error("expected an error for a row that changed since the last run")
+	}
+}
+
+// TestEngine_Rejected tests that rows rejected by Daraja fail without a result.
+func TestEngine_Rejected(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+	srv.Fail(mpesatest.PathB2CV3, mpesatest.Failure{Status: http.StatusBadRequest, ErrorCode: "400.002.02", ErrorMessage: "Bad Request - Invalid Initiator"})
+
+	report, err := newEngine(t, srv, payout.NewMemoryStore()).Run(context.Background(), "june", []payout.Payment{
+		{ID: "a", PhoneNumber: "254708374149", Amount: 100000},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record := report.Records[0]; record.Status != payout.StatusFailed || !strings.Contains(record.Error, "Invalid Initiator") {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+// dropResponse is a transport that loses the response to the first request
+// to path after the server has handled it.
+type dropResponse struct {
+	path    string
+	dropped atomic.Bool
+}
+
+// RoundTrip implements http.RoundTripper.
+func (d *dropResponse) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil && req.URL.Path == d.path && d.dropped.CompareAndSwap(false, true) {
+		resp.Body.Close()
+		return nil, errors.New("connection reset by peer")
+	}
+	return resp, err
+}
+
+// TestEngine_LostAcknowledgement tests that a row whose acknowledgement is lost
+// is retried under the same OriginatorConversationID and paid once.
+func TestEngine_LostAcknowledgement(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	engine := newEngine(t, srv, payout.NewMemoryStore())
+	engine.Client = srv.Client(
+		client.WithHTTPClient(&http.Client{Transport: &dropResponse{path: mpesatest.PathB2CV3}}),
+		client.WithRetryPolicy(&client.RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}),
+	)
+	report, err := engine.Run(context.Background(), "june", []payout.Payment{
+		{ID: "a", PhoneNumber: "254708374149", Amount: 100000},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if record := report.Records[0]; record.Status != payout.StatusSucceeded || record.OriginatorConversationID != "june/a" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if transactions := srv.Transactions(); len(transactions) != 1 || transactions[0].OriginatorConversationID != "june/a" {
+		t.Errorf("expected the row to be paid once, got %+v", transactions)
+	}
+}
+
+// TestEngine_InvalidBatchID tests that a batch ID that would make row IDs ambiguous is rejected.
+func TestEngine_InvalidBatchID(t *testing.T) {
+	srv := mpesatest.NewServer()
+	defer srv.Close()
+
+	_, err := newEngine(t, srv, payout.NewMemoryStore()).Run(context.Background(), "2024/june", []payout.Payment{
+		{ID: "a", PhoneNumber: "254708374149", Amount: 100000},
+	})
+	if err == nil || len(srv.Transactions()) != 0 {
+		t.Errorf("expected an error without payments, got %v", err)
+	}
+}
+
+// TestFileStore_TornLine tests that a partially written last record is ignored.
+func TestFileStore_TornLine(t *testing.T) {
+	dir := t.TempDir()
+	store, err := payout.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	payment := payout.Payment{ID: "a", PhoneNumber: "254708374149", Amount: 100000}
+	store.Save(ctx, "june", payout.Record{Payment: payment, Status: payout.StatusPending})
+	store.Save(ctx, "june", payout.Record{Payment: payment, Status: payout.StatusAccepted, ConversationID: "AG_1"})
+
+	f, err := os.OpenFile(filepath.Join(dir, "june.jsonl"), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"payment":{"id":"a"`)
+	f.Close()
+
+	records, err := store.Load(ctx, "june")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(records) != 1 || records[0].Status != payout.StatusAccepted || records[0].ConversationID != "AG_1" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	// A new store cuts off the torn line before appending the next record.
+	reopened, err := payout.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	reopened.Save(ctx, "june", payout.Record{Payment: payment, Status: payout.StatusSucceeded})
+	if records, _ := reopened.Load(ctx, "june"); len(records) != 1 || records[0].Status != payout.StatusSucceeded {
+		t.Errorf("unexpected records after reopening %+v", records)
+	}
+}
+
+// TestFileStore_CorruptLine tests that an unreadable line before the last one is an error.
+func TestFileStore_CorruptLine(t *testing.T) {
+	dir := t.TempDir()
+	payment := `{"payment":{"id":"a","phone":"254708374149","amount":100000},"status":"accepted"}`
+	if err := os.WriteFile(filepath.Join(dir, "june.jsonl"), []byte(payment+"\n{\"payment\":\n"+payment+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := payout.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if _, err := store.Load(context.Background(), "june"); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error for the corrupt line, got %v", err)
+	}
+}
+
+// TestFileStore_BatchID tests that batch IDs that are not file names are rejected.
+func TestFileStore_BatchID(t *testing.T) {
+	store, err := payout.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	ctx := context.Background()
+	record := payout.Record{Payment: payout.Payment{ID: "a", PhoneNumber: "254708374149", Amount: 100000}, Status: payout.StatusPending}
+
+	for _, batchID := range []string{"", "..", "2024/june", `2024\june`} {
+		if err := store.Save(ctx, batchID, record); err == nil {
+			t.Errorf("expected an error saving batch %q", batchID)
+		}
+		if _, err := store.Load(ctx, batchID); err == nil {
+			t.Errorf("expected an error loading batch %q", batchID)
+		}
+	}
+	if err := store.Save(ctx, "june", record); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if records, err := store.Load(ctx, "june"); err != nil || len(records) != 1 {
+		t.Errorf("unexpected records %+v, %v", records, err)
+	}
+}
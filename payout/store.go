@@ -0,0 +1,218 @@
+package payout
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Store persists the state of payout rows so an interrupted batch can resume
+// without paying a row twice. Implementations must be safe for concurrent use.
+type Store interface {
+	// Save records the latest state of a row of batchID.
+	Save(ctx context.Context, batchID string, record Record) error
+	// Load returns the latest state of every row saved for batchID.
+	Load(ctx context.Context, batchID string) ([]Record, error)
+}
+
+// MemoryStore is an in-process Store. It does not survive a crash; use
+// FileStore or a database-backed Store for batches that must resume.
+type MemoryStore struct {
+	mu      sync.Mutex
+	batches map[string]map[string]Record
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{batches: make(map[string]map[string]Record)}
+}
+
+// Save implements Store.
+func (s *MemoryStore) Save(ctx context.Context, batchID string, record Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.batches == nil {
+		s.batches = make(map[string]map[string]Record)
+	}
+	if s.batches[batchID] == nil {
+		s.batches[batchID] = make(map[string]Record)
+	}
+	s.batches[batchID][record.Payment.ID] = record
+	return nil
+}
+
+// Load implements Store.
+func (s *MemoryStore) Load(ctx context.Context, batchID string) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]Record, 0, len(s.batches[batchID]))
+	for _, record := range s.batches[batchID] {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// FileStore is a Store that appends every state change of a batch to a JSON
+// lines file named after the batch in Dir, syncing it to disk before Save
+// returns.
+type FileStore struct {
+	// Dir is the directory holding the batch files.
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]*os.File
+}
+
+// NewFileStore returns a FileStore writing to dir, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create payout store: %w", err)
+	}
+	return &FileStore{Dir: dir, files: make(map[string]*os.File)}, nil
+}
+
+// path returns the file of batchID. Batch IDs that are not plain file names
+// are rejected rather than cleaned, so that two batches never share a file.
+func (s *FileStore) path(batchID string) (string, error) {
+	if batchID == "" || batchID == "." || batchID == ".." || strings.ContainsAny(batchID, `/\`) {
+		return "", fmt.Errorf("invalid batch ID %q: must be a file name", batchID)
+	}
+	return filepath.Join(s.Dir, batchID+".jsonl"), nil
+}
+
+// openLog opens a batch file for appending. A torn last line is cut off so
+// that the next record starts on a line of its own and only the last line of
+// a batch file can ever be torn.
+func openLog(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payout store: %w", err)
+	}
+	info, err := f.Stat()
+	if err == nil {
+		var size int64
+		if size, err = completeLines(f, info.Size()); err == nil && size < info.Size() {
+			err = f.Truncate(size)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to open payout store: %w", err)
+	}
+	return f, nil
+}
+
+// completeLines returns the length of the newline-terminated lines at the
+// start of f, a file of the given size.
+func completeLines(f *os.File, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// Save implements Store.
+func (s *FileStore) Save(ctx context.Context, batchID string, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode payout record: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.files == nil {
+		s.files = make(map[string]*os.File)
+	}
+	f, ok := s.files[batchID]
+	if !ok {
+		path, err := s.path(batchID)
+		if err != nil {
+			return err
+		}
+		if f, err = openLog(path); err != nil {
+			return err
+		}
+		s.files[batchID] = f
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write payout record: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync payout store: %w", err)
+	}
+	return nil
+}
+
+// Load implements Store. A torn last line, left by a crash during Save, is
+// ignored; any other unreadable line is an error, since skipping it could
+// forget that a row was sent.
+func (s *FileStore) Load(ctx context.Context, batchID string) ([]Record, error) {
+	path, err := s.path(batchID)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open payout store: %w", err)
+	}
+	defer f.Close()
+
+	latest := make(map[string]int)
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var torn error
+	for line := 1; scanner.Scan(); line++ {
+		if torn != nil {
+			return nil, torn
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			torn = fmt.Errorf("corrupt payout store %s: line %d: %w", path, line, err)
+			continue
+		}
+		if i, ok := latest[record.Payment.ID]; ok {
+			records[i] = record
+			continue
+		}
+		latest[record.Payment.ID] = len(records)
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read payout store: %w", err)
+	}
+	return records, nil
+}
+
+// Close closes the open batch files.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for batchID, f := range s.files {
+		errs = append(errs, f.Close())
+		delete(s.files, batchID)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,69 @@
+// Package phone normalizes Kenyan mobile numbers into the MSISDN form Daraja
+// expects, 2547XXXXXXXX or 2541XXXXXXXX.
+package phone
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalid is returned for numbers that are not Kenyan mobile numbers.
+var ErrInvalid = errors.New("invalid Kenyan mobile number")
+
+// countryCode is Kenya's international dialling code.
+const countryCode = "254"
+
+// Normalize converts a Kenyan mobile number in any common format into
+// 2547XXXXXXXX or 2541XXXXXXXX form. Spaces, dashes, dots and parentheses
+// are ignored, and a leading + or 00 is accepted:
+//
+//	0712 345 678, +254712345678, 254712345678, 712345678  ->  254712345678
+//	0110-345-678, 00254110345678, 110345678               ->  254110345678
+func Normalize(number string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')', '\t':
+			return -1
+		}
+		return r
+	}, number)
+	digits = strings.TrimPrefix(digits, "+")
+	if strings.HasPrefix(digits, "00"+countryCode) {
+		digits = digits[2:]
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, number)
+		}
+	}
+
+	var subscriber string
+	switch {
+	case len(digits) == 12 && strings.HasPrefix(digits, countryCode):
+		subscriber = digits[3:]
+	case len(digits) == 13 && strings.HasPrefix(digits, countryCode+"0"):
+		subscriber = digits[4:]
+	case len(digits) == 10 && digits[0] == '0':
+		subscriber = digits[1:]
+	case len(digits) == 9:
+		subscriber = digits
+	}
+	if subscriber == "" || (subscriber[0] != '7' && subscriber[0] != '1') {
+		return "", fmt.Errorf("%w: %q", ErrInvalid, number)
+	}
+	return countryCode + subscriber, nil
+}
+
+// Valid reports whether number is already in 2547XXXXXXXX or 2541XXXXXXXX form.
+func Valid(number string) bool {
+	if len(number) != 12 || !(strings.HasPrefix(number, "2547") || strings.HasPrefix(number, "2541")) {
+		return false
+	}
+	for _, r := range number {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
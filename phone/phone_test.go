@@ -0,0 +1,51 @@
+// Package phone_test contains unit tests for phone number normalization.
+package phone_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/freelancer254/mpesa-go/phone"
+)
+
+// TestNormalize tests converting common Kenyan formats into MSISDN form.
+func TestNormalize(t *testing.T) {
+	for input, want := range map[string]string{
+		"0712345678":         "254712345678",
+		"0712 345 678":       "254712345678",
+		"+254712345678":      "254712345678",
+		"+254 (712) 345-678": "254712345678",
+		"254712345678":       "254712345678",
+		"2540712345678":      "254712345678",
+		"00254712345678":     "254712345678",
+		"712345678":          "254712345678",
+		"0110345678":         "254110345678",
+		"110345678":          "254110345678",
+	} {
+		got, err := phone.Normalize(input)
+		if err != nil || got != want {
+			t.Errorf("Normalize(%q) = %q, %v; expected %q", input, got, err, want)
+		}
+	}
+}
+
+// TestNormalize_Invalid tests that numbers that are not Kenyan mobile numbers are rejected.
+func TestNormalize_Invalid(t *testing.T) {
+	for _, input := range []string{"", "0201234567", "071234567", "25571234567", "+1 212 555 0100", "07123456789", "07l2345678"} {
+		if got, err := phone.Normalize(input); !errors.Is(err, phone.ErrInvalid) {
+			t.Errorf("Normalize(%q) = %q, %v; expected ErrInvalid", input, got, err)
+		}
+	}
+}
+
+// TestValid tests recognizing numbers already in MSISDN form.
+func TestValid(t *testing.T) {
+	if !phone.Valid("254712345678") || !phone.Valid("254110345678") {
+		t.Error("expected MSISDNs to be valid")
+	}
+	for _, input := range []string{"0712345678", "+254712345678", "254212345678", "2547123456789"} {
+		if phone.Valid(input) {
+			t.Errorf("expected %q to be invalid", input)
+		}
+	}
+}
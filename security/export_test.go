@@ -0,0 +1,13 @@
+package security
+
+import (
+	"io/fs"
+	"testing"
+)
+
+// SetBundled replaces the embedded certificates for the rest of the test.
+func SetBundled(t *testing.T, fsys fs.FS) {
+	previous := bundled
+	bundled = fsys
+	t.Cleanup(func() { bundled = previous })
+}
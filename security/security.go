@@ -0,0 +1,107 @@
+// Package security generates the SecurityCredential required by the Daraja
+// APIs that act on behalf of an initiator (B2C, B2B, reversal, transaction
+// status and account balance).
+package security
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"embed"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+//go:embed certs
+var embedded embed.FS
+
+// bundled holds the certificates read by SandboxCertificate and
+// ProductionCertificate; tests replace it.
+var bundled fs.FS = embedded
+
+// ErrCertificateNotBundled is returned when the requested Safaricom
+// certificate was not embedded at build time.
+var ErrCertificateNotBundled = errors.New("certificate not bundled")
+
+// SandboxCertificate returns the embedded Daraja sandbox public certificate.
+func SandboxCertificate() (*x509.Certificate, error) {
+	return bundledCertificate("certs/sandbox.cer")
+}
+
+// ProductionCertificate returns the embedded Daraja production public certificate.
+func ProductionCertificate() (*x509.Certificate, error) {
+	return bundledCertificate("certs/production.cer")
+}
+
+// bundledCertificate parses an embedded certificate file.
+func bundledCertificate(name string) (*x509.Certificate, error) {
+	data, err := fs.ReadFile(bundled, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", name, ErrCertificateNotBundled)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return ParseCertificate(data)
+}
+
+// LoadCertificate reads a PEM or DER (.cer) certificate from path.
+func LoadCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	return ParseCertificate(data)
+}
+
+// ParseCertificate parses a PEM or DER encoded X.509 certificate.
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, fmt.Errorf("certificate public key is %T, want RSA", cert.PublicKey)
+	}
+	return cert, nil
+}
+
+// EncryptCredential encrypts the initiator password with the certificate's
+// RSA public key (PKCS#1 v1.5) and returns it base64 encoded, ready to be
+// used as a SecurityCredential.
+func EncryptCredential(cert *x509.Certificate, initiatorPassword string) (string, error) {
+	key, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", fmt.Errorf("certificate public key is %T, want RSA", cert.PublicKey)
+	}
+	encrypted, err := rsa.EncryptPKCS1v15(rand.Reader, key, []byte(initiatorPassword))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt initiator password: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// SandboxCredential encrypts the initiator password with the sandbox certificate.
+func SandboxCredential(initiatorPassword string) (string, error) {
+	cert, err := SandboxCertificate()
+	if err != nil {
+		return "", err
+	}
+	return EncryptCredential(cert, initiatorPassword)
+}
+
+// ProductionCredential encrypts the initiator password with the production certificate.
+func ProductionCredential(initiatorPassword string) (string, error) {
+	cert, err := ProductionCertificate()
+	if err != nil {
+		return "", err
+	}
+	return EncryptCredential(cert, initiatorPassword)
+}
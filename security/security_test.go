@@ -0,0 +1,141 @@
+// Package security_test contains unit tests for the security credential helpers.
+package security_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/security"
+)
+
+// testCertificate creates a self-signed RSA certificate and returns its DER bytes and private key.
+func testCertificate(t *testing.T) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apicrypt.safaricom.co.ke"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return der, key
+}
+
+// TestEncryptCredential tests that a credential decrypts back to the initiator password.
+func TestEncryptCredential(t *testing.T) {
+	der, key := testCertificate(t)
+	cert, err := security.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	credential, err := security.EncryptCredential(cert, "Safaricom999!*!")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(credential)
+	if err != nil {
+		t.Fatalf("expected base64 credential, got %v", err)
+	}
+	plain, err := rsa.DecryptPKCS1v15(rand.Reader, key, encrypted)
+	if err != nil {
+		t.Fatalf("failed to decrypt credential: %v", err)
+	}
+	if string(plain) != "Safaricom999!*!" {
+		t.Errorf("expected password %s, got %s", "Safaricom999!*!", plain)
+	}
+}
+
+// TestLoadCertificate_PEM tests loading a PEM encoded certificate from disk.
+func TestLoadCertificate_PEM(t *testing.T) {
+	der, _ := testCertificate(t)
+	path := filepath.Join(t.TempDir(), "cert.cer")
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write certificate: %v", err)
+	}
+
+	cert, err := security.LoadCertificate(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if cert.Subject.CommonName != "apicrypt.safaricom.co.ke" {
+		t.Errorf("expected common name %s, got %s", "apicrypt.safaricom.co.ke", cert.Subject.CommonName)
+	}
+}
+
+// TestParseCertificate_Invalid tests that garbage input is rejected.
+func TestParseCertificate_Invalid(t *testing.T) {
+	if _, err := security.ParseCertificate([]byte("not a certificate")); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+// TestBundledCertificates tests that the embedded Daraja certificates are usable.
+func TestBundledCertificates(t *testing.T) {
+	for name, load := range map[string]func() (*x509.Certificate, error){
+		"sandbox":    security.SandboxCertificate,
+		"production": security.ProductionCertificate,
+	} {
+		cert, err := load()
+		if errors.Is(err, security.ErrCertificateNotBundled) {
+			t.Skipf("%s certificate not bundled, see security/certs/README.md", name)
+		}
+		if err != nil {
+			t.Errorf("%s: expected the bundled certificate to parse, got %v", name, err)
+			continue
+		}
+		if _, err := security.EncryptCredential(cert, "Safaricom999!*!"); err != nil {
+			t.Errorf("%s: expected no error, got %v", name, err)
+		}
+	}
+}
+
+// TestBundledCredential tests that credentials from the bundled certificates decrypt back to the initiator password.
+func TestBundledCredential(t *testing.T) {
+	der, key := testCertificate(t)
+	security.SetBundled(t, fstest.MapFS{
+		"certs/sandbox.cer":    {Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})},
+		"certs/production.cer": {Data: der},
+	})
+
+	for name, credential := range map[string]func(string) (string, error){
+		"sandbox":    security.SandboxCredential,
+		"production": security.ProductionCredential,
+	} {
+		encoded, err := credential("Safaricom999!*!")
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", name, err)
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("%s: expected base64 credential, got %v", name, err)
+		}
+		plain, err := rsa.DecryptPKCS1v15(rand.Reader, key, encrypted)
+		if err != nil || string(plain) != "Safaricom999!*!" {
+			t.Errorf("%s: expected the password back, got %q, %v", name, plain, err)
+		}
+	}
+
+	security.SetBundled(t, fstest.MapFS{})
+	if _, err := security.SandboxCredential("Safaricom999!*!"); !errors.Is(err, security.ErrCertificateNotBundled) {
+		t.Errorf("expected ErrCertificateNotBundled, got %v", err)
+	}
+}
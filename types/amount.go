@@ -0,0 +1,139 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency is the currency of every Amount.
+const Currency = "KES"
+
+// Amount is an exact amount of money in cents (hundredths of a shilling).
+// Build whole amounts from Shilling, e.g. 1500 * types.Shilling.
+type Amount int64
+
+// Shilling is one Kenyan shilling.
+const Shilling Amount = 100
+
+// ParseAmount parses a decimal amount such as "700000.00", "-4510" or "0.5".
+// More than two fraction digits are rejected rather than rounded.
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	value := s
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	if whole == "" && !hasFrac || len(frac) > 2 || hasFrac && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<63-1)/100-1 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	cents, _ := strconv.ParseInt((frac + "00")[:2], 10, 64)
+	amount := Amount(units*100 + cents)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// String formats the amount with two decimal places, e.g. "700000.00".
+func (a Amount) String() string {
+	sign := ""
+	cents := int64(a)
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// Shillings returns the whole shillings of the amount, truncated toward zero.
+func (a Amount) Shillings() int64 {
+	return int64(a / Shilling)
+}
+
+// Cents returns the amount in cents.
+func (a Amount) Cents() int64 {
+	return int64(a)
+}
+
+// IsWhole reports whether the amount is a whole number of shillings.
+func (a Amount) IsWhole() bool {
+	return a%Shilling == 0
+}
+
+// Add returns a+b.
+func (a Amount) Add(b Amount) Amount {
+	return a + b
+}
+
+// Sub returns a-b.
+func (a Amount) Sub(b Amount) Amount {
+	return a - b
+}
+
+// Mul returns the amount multiplied by n.
+func (a Amount) Mul(n int64) Amount {
+	return a * Amount(n)
+}
+
+// Abs returns the absolute value of the amount.
+func (a Amount) Abs() Amount {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+// Sum returns the total of amounts.
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, amount := range amounts {
+		total += amount
+	}
+	return total
+}
+
+// MarshalJSON implements json.Marshaler. Whole amounts encode as integers,
+// e.g. 1500, which is what Daraja requests accept; others as decimals, e.g. 1500.50.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.IsWhole() {
+		return []byte(strconv.FormatInt(a.Shillings(), 10)), nil
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Daraja sends amounts as JSON
+// numbers or strings, e.g. 1500, 1500.00 or "1500.00".
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		s = string(data)
+	}
+	if s == "" {
+		*a = 0
+		return nil
+	}
+	amount, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+	*a = amount
+	return nil
+}
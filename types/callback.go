@@ -0,0 +1,212 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// CallbackItem is a single Name/Value pair of callback metadata. Daraja sends
+// values as JSON numbers or strings, and omits the value of empty items.
+type CallbackItem struct {
+	Name  string          `json:"Name"`
+	Value json.RawMessage `json:"Value,omitempty"`
+}
+
+// String returns the item value as a string, without quotes for string values.
+func (i CallbackItem) String() string {
+	var s string
+	if err := json.Unmarshal(i.Value, &s); err == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(i.Value))
+}
+
+// STKCallbackBody is the raw payload Daraja posts to an STK Push CallBackURL.
+type STKCallbackBody struct {
+	Body struct {
+		StkCallback struct {
+			MerchantRequestID string      `json:"MerchantRequestID"`
+			CheckoutRequestID string      `json:"CheckoutRequestID"`
+			ResultCode        json.Number `json:"ResultCode"`
+			ResultDesc        string      `json:"ResultDesc"`
+			CallbackMetadata  struct {
+				Item []CallbackItem `json:"Item"`
+			} `json:"CallbackMetadata"`
+		} `json:"stkCallback"`
+	} `json:"Body"`
+}
+
+// STKCallback is the typed outcome of an STK Push, decoded from STKCallbackBody.
+// The payment fields are only set when ResultCode is ResultCodeSuccess.
+type STKCallback struct {
+	MerchantRequestID  string
+	CheckoutRequestID  string
+	ResultCode         string
+	ResultDesc         string
+	Amount             Amount
+	MpesaReceiptNumber string
+	TransactionDate    time.Time
+	PhoneNumber        string
+	Items              []CallbackItem
+}
+
+// Success reports whether the customer completed the payment.
+func (c *STKCallback) Success() bool {
+	return c.ResultCode == ResultCodeSuccess
+}
+
+// ParseSTKCallback decodes the JSON body Daraja posts to an STK Push CallBackURL.
+func ParseSTKCallback(data []byte) (*STKCallback, error) {
+	var body STKCallbackBody
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode STK callback: %w", err)
+	}
+	raw := body.Body.StkCallback
+	if raw.CheckoutRequestID == "" || raw.ResultCode == "" {
+		return nil, fmt.Errorf("invalid STK callback: missing CheckoutRequestID or ResultCode")
+	}
+
+	cb := &STKCallback{
+		MerchantRequestID: raw.MerchantRequestID,
+		CheckoutRequestID: raw.CheckoutRequestID,
+		ResultCode:        raw.ResultCode.String(),
+		ResultDesc:        raw.ResultDesc,
+		Items:             raw.CallbackMetadata.Item,
+	}
+	for _, item := range cb.Items {
+		value := item.String()
+		if value == "" {
+			continue
+		}
+		var err error
+		switch item.Name {
+		case "Amount":
+			cb.Amount, err = ParseAmount(value)
+		case "MpesaReceiptNumber":
+			cb.MpesaReceiptNumber = value
+		case "TransactionDate":
+			cb.TransactionDate, err = utils.ParseTimestamp(value)
+		case "PhoneNumber":
+			cb.PhoneNumber = value
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid STK callback %s %q: %w", item.Name, value, err)
+		}
+	}
+	return cb, nil
+}
+
+// B2BExpressCheckoutCallback is the outcome of a B2B Express Checkout,
+// posted to its CallbackURL. TransactionID and ConversationID are only set
+// when the payment succeeded; PaymentReference is echoed on failures.
+type B2BExpressCheckoutCallback struct {
+	ResultCode       string
+	ResultDesc       string
+	ResultType       string
+	RequestID        string
+	Amount           Amount
+	ConversationID   string
+	TransactionID    string
+	Status           string
+	PaymentReference string
+}
+
+// Success reports whether the till operator completed the payment.
+func (c *B2BExpressCheckoutCallback) Success() bool {
+	return c.ResultCode == ResultCodeSuccess
+}
+
+// ParseB2BExpressCheckoutCallback decodes the JSON body Daraja posts to a B2B
+// Express Checkout callbackUrl.
+func ParseB2BExpressCheckoutCallback(data []byte) (*B2BExpressCheckoutCallback, error) {
+	var raw struct {
+		ResultCode       flexString `json:"resultCode"`
+		ResultDesc       string     `json:"resultDesc"`
+		ResultType       flexString `json:"resultType"`
+		RequestID        string     `json:"requestId"`
+		Amount           Amount     `json:"amount"`
+		ConversationID   string     `json:"conversationID"`
+		TransactionID    string     `json:"transactionId"`
+		Status           string     `json:"status"`
+		PaymentReference string     `json:"paymentReference"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode B2B Express Checkout callback: %w", err)
+	}
+	if raw.ResultCode == "" {
+		return nil, fmt.Errorf("invalid B2B Express Checkout callback: missing resultCode")
+	}
+	return &B2BExpressCheckoutCallback{
+		ResultCode:       string(raw.ResultCode),
+		ResultDesc:       raw.ResultDesc,
+		ResultType:       string(raw.ResultType),
+		RequestID:        raw.RequestID,
+		Amount:           raw.Amount,
+		ConversationID:   raw.ConversationID,
+		TransactionID:    raw.TransactionID,
+		Status:           raw.Status,
+		PaymentReference: raw.PaymentReference,
+	}, nil
+}
+
+// C2BTransaction is the payload Daraja posts to the C2B validation and
+// confirmation URLs registered with RegisterURL.
+type C2BTransaction struct {
+	TransactionType   string `json:"TransactionType"`
+	TransID           string `json:"TransID"`
+	TransTime         string `json:"TransTime"`
+	TransAmount       Amount `json:"TransAmount"`
+	BusinessShortCode string `json:"BusinessShortCode"`
+	BillRefNumber     string `json:"BillRefNumber"`
+	InvoiceNumber     string `json:"InvoiceNumber"`
+	OrgAccountBalance Amount `json:"OrgAccountBalance"`
+	ThirdPartyTransID string `json:"ThirdPartyTransID"`
+	MSISDN            string `json:"MSISDN"`
+	FirstName         string `json:"FirstName"`
+	MiddleName        string `json:"MiddleName"`
+	LastName          string `json:"LastName"`
+}
+
+// Time parses TransTime as Nairobi time.
+func (t *C2BTransaction) Time() (time.Time, error) {
+	return utils.ParseTimestamp(t.TransTime)
+}
+
+// C2B validation result codes used to accept or reject a payment.
+const (
+	C2BAccepted             = "0"
+	C2BInvalidMSISDN        = "C2B00011"
+	C2BInvalidAccountNumber = "C2B00012"
+	C2BInvalidAmount        = "C2B00013"
+	C2BInvalidKYCDetails    = "C2B00014"
+	C2BInvalidShortcode     = "C2B00015"
+	C2BOtherError           = "C2B00016"
+)
+
+// c2bResultDescriptions maps C2B validation result codes to descriptions.
+var c2bResultDescriptions = map[string]string{
+	C2BAccepted:             "Accepted",
+	C2BInvalidMSISDN:        "Invalid MSISDN",
+	C2BInvalidAccountNumber: "Invalid Account Number",
+	C2BInvalidAmount:        "Invalid Amount",
+	C2BInvalidKYCDetails:    "Invalid KYC Details",
+	C2BInvalidShortcode:     "Invalid Shortcode",
+	C2BOtherError:           "Other Error",
+}
+
+// C2BResultDescription returns the description of a C2B validation result code.
+func C2BResultDescription(code string) string {
+	return c2bResultDescriptions[code]
+}
+
+// C2BValidationResponse is the body returned to Daraja from the validation URL.
+type C2BValidationResponse struct {
+	ResultCode string `json:"ResultCode"`
+	ResultDesc string `json:"ResultDesc"`
+}
@@ -0,0 +1,114 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Sentinel errors for common Daraja failures. Use errors.Is against an error
+// returned by the client to branch on them.
+var (
+	ErrInvalidAccessToken    = errors.New("invalid access token")
+	ErrInvalidCredentials    = errors.New("invalid consumer credentials")
+	ErrInvalidShortCode      = errors.New("invalid shortcode")
+	ErrDuplicateRequest      = errors.New("duplicate request")
+	ErrInsufficientBalance   = errors.New("insufficient balance")
+	ErrTransactionProcessing = errors.New("transaction is still being processed")
+	ErrRateLimited           = errors.New("rate limited")
+	ErrServiceUnavailable    = errors.New("service unavailable")
+)
+
+// APIError is returned for any non-2xx response from Daraja.
+type APIError struct {
+	StatusCode   int    `json:"-"`
+	RequestID    string `json:"requestId"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// ParseAPIError builds an APIError from an HTTP status and response body.
+// Bodies that are not Daraja error JSON are kept as the error message.
+func ParseAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{}
+	if err := json.Unmarshal(body, apiErr); err != nil || (apiErr.ErrorCode == "" && apiErr.ErrorMessage == "") {
+		apiErr = &APIError{ErrorMessage: strings.TrimSpace(string(body))}
+	}
+	apiErr.StatusCode = statusCode
+	if apiErr.ErrorMessage == "" {
+		apiErr.ErrorMessage = http.StatusText(statusCode)
+	}
+	return apiErr
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("mpesa API error (status %d", e.StatusCode)
+	if e.ErrorCode != "" {
+		msg += ", code " + e.ErrorCode
+	}
+	if e.RequestID != "" {
+		msg += ", request " + e.RequestID
+	}
+	return msg + "): " + e.ErrorMessage
+}
+
+// Is reports whether the error matches one of the sentinel errors.
+func (e *APIError) Is(target error) bool {
+	message := strings.ToLower(e.ErrorMessage)
+	switch target {
+	case ErrInvalidAccessToken:
+		return e.ErrorCode == "404.001.03" || e.StatusCode == http.StatusUnauthorized
+	case ErrInvalidCredentials:
+		return strings.HasPrefix(e.ErrorCode, "400.008.")
+	case ErrInvalidShortCode:
+		return strings.Contains(message, "shortcode") || strings.Contains(message, "merchant does not exist")
+	case ErrDuplicateRequest:
+		return strings.Contains(message, "duplicate")
+	case ErrInsufficientBalance:
+		return strings.Contains(message, "insufficient")
+	case ErrTransactionProcessing:
+		return strings.Contains(message, "being processed")
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServiceUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// Daraja result codes reported in STK and asynchronous result callbacks.
+const (
+	ResultCodeSuccess            = "0"
+	ResultCodeInsufficientFunds  = "1"
+	ResultCodeSubscriberLocked   = "1001"
+	ResultCodeTransactionExpired = "1019"
+	ResultCodePushRequestError   = "1025"
+	ResultCodeCancelledByUser    = "1032"
+	ResultCodeUserUnreachable    = "1037"
+	ResultCodeInvalidInitiator   = "2001"
+	ResultCodeStillProcessing    = "4999"
+	ResultCodeInternalError      = "9999"
+)
+
+// resultCodeDescriptions maps result codes to human-readable descriptions.
+var resultCodeDescriptions = map[string]string{
+	ResultCodeSuccess:            "The service request is processed successfully.",
+	ResultCodeInsufficientFunds:  "The balance is insufficient for the transaction.",
+	ResultCodeSubscriberLocked:   "Unable to lock subscriber, a transaction is already in process for the current subscriber.",
+	ResultCodeTransactionExpired: "Transaction has expired.",
+	ResultCodePushRequestError:   "An error occurred while sending a push request.",
+	ResultCodeCancelledByUser:    "Request cancelled by user.",
+	ResultCodeUserUnreachable:    "DS timeout user cannot be reached.",
+	ResultCodeInvalidInitiator:   "The initiator information is invalid.",
+	ResultCodeStillProcessing:    "The transaction is still under processing.",
+	ResultCodeInternalError:      "An error occurred while processing the request.",
+}
+
+// ResultCodeDescription returns the description of a known result code, or an
+// empty string if the code is not catalogued.
+func ResultCodeDescription(code string) string {
+	return resultCodeDescriptions[code]
+}
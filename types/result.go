@@ -0,0 +1,461 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// flexString decodes from a JSON string or number, as Daraja uses both.
+type flexString string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (f *flexString) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*f = flexString(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("expected string or number, got %s", data)
+	}
+	*f = flexString(n)
+	return nil
+}
+
+// ResultParameter is a single Key/Value pair of a result callback. Daraja
+// sends values as JSON numbers or strings.
+type ResultParameter struct {
+	Key   string          `json:"Key"`
+	Value json.RawMessage `json:"Value,omitempty"`
+}
+
+// String returns the parameter value as a string, without quotes for string values.
+func (p ResultParameter) String() string {
+	var s string
+	if err := json.Unmarshal(p.Value, &s); err == nil {
+		return s
+	}
+	return string(bytes.TrimSpace(p.Value))
+}
+
+// resultParameters decodes either a single ResultParameter or a list of them.
+type resultParameters []ResultParameter
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *resultParameters) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		var single ResultParameter
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+		*p = resultParameters{single}
+		return nil
+	}
+	var list []ResultParameter
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// resultBody is the raw payload Daraja posts to a ResultURL or QueueTimeOutURL.
+type resultBody struct {
+	Result struct {
+		ResultType               flexString `json:"ResultType"`
+		ResultCode               flexString `json:"ResultCode"`
+		ResultDesc               string     `json:"ResultDesc"`
+		OriginatorConversationID string     `json:"OriginatorConversationID"`
+		ConversationID           string     `json:"ConversationID"`
+		TransactionID            string     `json:"TransactionID"`
+		ResultParameters         struct {
+			ResultParameter resultParameters `json:"ResultParameter"`
+		} `json:"ResultParameters"`
+		ReferenceData struct {
+			ReferenceItem resultParameters `json:"ReferenceItem"`
+		} `json:"ReferenceData"`
+	} `json:"Result"`
+}
+
+// Result is the asynchronous outcome of a B2C, B2B, reversal, transaction
+// status or account balance request, posted to its ResultURL. Timeouts posted
+// to QueueTimeOutURL use the same shape.
+//
+// The typed results (B2CResult, B2BResult, ...) are read from Parameters.
+// A parameter that cannot be read leaves its field zero and is reported in
+// ParseError; the rest of the result is still filled in.
+type Result struct {
+	ResultType               string
+	ResultCode               string
+	ResultDesc               string
+	OriginatorConversationID string
+	ConversationID           string
+	TransactionID            string
+	Parameters               []ResultParameter
+	ReferenceData            []ResultParameter
+	// ParseError is the first parameter a typed result could not read.
+	ParseError error `json:"-"`
+}
+
+// Success reports whether the request completed successfully.
+func (r *Result) Success() bool {
+	return r.ResultCode == ResultCodeSuccess
+}
+
+// Param returns the value of the named result parameter, or "" if absent.
+func (r *Result) Param(key string) string {
+	for _, p := range r.Parameters {
+		if p.Key == key {
+			return p.String()
+		}
+	}
+	return ""
+}
+
+// ParseResult decodes the JSON body Daraja posts to a ResultURL or QueueTimeOutURL.
+func ParseResult(data []byte) (*Result, error) {
+	var body resultBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to decode result: %w", err)
+	}
+	raw := body.Result
+	if raw.ConversationID == "" && raw.OriginatorConversationID == "" {
+		return nil, fmt.Errorf("invalid result: missing ConversationID and OriginatorConversationID")
+	}
+	return &Result{
+		ResultType:               string(raw.ResultType),
+		ResultCode:               string(raw.ResultCode),
+		ResultDesc:               raw.ResultDesc,
+		OriginatorConversationID: raw.OriginatorConversationID,
+		ConversationID:           raw.ConversationID,
+		TransactionID:            raw.TransactionID,
+		Parameters:               raw.ResultParameters.ResultParameter,
+		ReferenceData:            raw.ReferenceData.ReferenceItem,
+	}, nil
+}
+
+// resultParser reads typed values out of result parameters, keeping the first
+// error and carrying on with the remaining parameters.
+type resultParser struct {
+	result *Result
+	err    error
+}
+
+// string returns the named parameter as is.
+func (p *resultParser) string(key string) string {
+	return p.result.Param(key)
+}
+
+// amount parses the named parameter as an exact amount; absent parameters yield 0.
+func (p *resultParser) amount(key string) Amount {
+	value := p.result.Param(key)
+	if value == "" {
+		return 0
+	}
+	amount, err := ParseAmount(value)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid result parameter %s %q: %w", key, value, err)
+	}
+	return amount
+}
+
+// balance parses the named balance or charge parameter, which Daraja sends
+// as a plain amount, as a pipe-delimited entry such as
+// "Working Account|KES|46713.00|46713.00|0.00|0.00" or
+// "Business Pay Bill Charge|KES|77.00", whose first amount is taken, or as
+// "{Amount={BasicAmount=46713.00, MinimumAmount=4671300, CurrencyCode=KES}}".
+// Absent parameters yield 0.
+func (p *resultParser) balance(key string) Amount {
+	value := p.result.Param(key)
+	amount := value
+	if fields := strings.Split(value, "|"); len(fields) >= 3 {
+		amount = fields[2]
+	} else if _, rest, ok := strings.Cut(value, "BasicAmount="); ok {
+		amount, _, _ = strings.Cut(rest, ",")
+		amount = strings.TrimRight(amount, "}")
+	}
+	if amount == "" {
+		return 0
+	}
+	parsed, err := ParseAmount(strings.TrimSpace(amount))
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid result parameter %s %q: %w", key, value, err)
+	}
+	return parsed
+}
+
+// time parses the named parameter with layout in Nairobi time; absent parameters yield the zero time.
+func (p *resultParser) time(key, layout string) time.Time {
+	value := p.result.Param(key)
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(layout, value, utils.Nairobi)
+	if err != nil && p.err == nil {
+		p.err = fmt.Errorf("invalid result parameter %s %q: %w", key, value, err)
+	}
+	return t
+}
+
+// B2CResult is the typed result of a B2C payment.
+type B2CResult struct {
+	Result
+	TransactionAmount                   Amount
+	TransactionReceipt                  string
+	B2CRecipientIsRegisteredCustomer    bool
+	B2CChargesPaidAccountAvailableFunds Amount
+	ReceiverPartyPublicName             string
+	TransactionCompletedDateTime        time.Time
+	B2CUtilityAccountAvailableFunds     Amount
+	B2CWorkingAccountAvailableFunds     Amount
+}
+
+// ParseB2CResult decodes the result of a B2C payment.
+func ParseB2CResult(data []byte) (*B2CResult, error) {
+	result, err := ParseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.AsB2C()
+}
+
+// AsB2C reads the typed fields of a B2C payment result from the result parameters.
+func (r *Result) AsB2C() (*B2CResult, error) {
+	p := &resultParser{result: r}
+	out := &B2CResult{
+		Result:                              *r,
+		TransactionAmount:                   p.amount("TransactionAmount"),
+		TransactionReceipt:                  p.string("TransactionReceipt"),
+		B2CRecipientIsRegisteredCustomer:    p.string("B2CRecipientIsRegisteredCustomer") == "Y",
+		B2CChargesPaidAccountAvailableFunds: p.amount("B2CChargesPaidAccountAvailableFunds"),
+		ReceiverPartyPublicName:             p.string("ReceiverPartyPublicName"),
+		TransactionCompletedDateTime:        p.time("TransactionCompletedDateTime", "02.01.2006 15:04:05"),
+		B2CUtilityAccountAvailableFunds:     p.amount("B2CUtilityAccountAvailableFunds"),
+		B2CWorkingAccountAvailableFunds:     p.amount("B2CWorkingAccountAvailableFunds"),
+	}
+	out.ParseError = p.err
+	return out, p.err
+}
+
+// B2BResult is the typed result of a B2B payment.
+type B2BResult struct {
+	Result
+	Amount                           Amount
+	Currency                         string
+	DebitAccountBalance              Amount
+	DebitPartyAffectedAccountBalance Amount
+	DebitPartyCharges                Amount
+	InitiatorAccountCurrentBalance   Amount
+	ReceiverPartyPublicName          string
+	TransCompletedTime               time.Time
+}
+
+// ParseB2BResult decodes the result of a B2B payment.
+func ParseB2BResult(data []byte) (*B2BResult, error) {
+	result, err := ParseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.AsB2B()
+}
+
+// AsB2B reads the typed fields of a B2B payment result from the result parameters.
+func (r *Result) AsB2B() (*B2BResult, error) {
+	p := &resultParser{result: r}
+	out := &B2BResult{
+		Result:                           *r,
+		Amount:                           p.amount("Amount"),
+		Currency:                         p.string("Currency"),
+		DebitAccountBalance:              p.balance("DebitAccountBalance"),
+		DebitPartyAffectedAccountBalance: p.balance("DebitPartyAffectedAccountBalance"),
+		DebitPartyCharges:                p.balance("DebitPartyCharges"),
+		InitiatorAccountCurrentBalance:   p.balance("InitiatorAccountCurrentBalance"),
+		ReceiverPartyPublicName:          p.string("ReceiverPartyPublicName"),
+		TransCompletedTime:               p.time("TransCompletedTime", utils.TimestampLayout),
+	}
+	out.ParseError = p.err
+	return out, p.err
+}
+
+// RemitTaxResult is the typed result of a tax remittance to KRA, which
+// Daraja reports like any other B2B payment.
+type RemitTaxResult = B2BResult
+
+// ParseRemitTaxResult decodes the result of a tax remittance.
+func ParseRemitTaxResult(data []byte) (*RemitTaxResult, error) {
+	return ParseB2BResult(data)
+}
+
+// ReversalResult is the typed result of a transaction reversal.
+type ReversalResult struct {
+	Result
+	Amount                Amount
+	OriginalTransactionID string
+	Charge                Amount
+	CreditPartyPublicName string
+	DebitPartyPublicName  string
+	DebitAccountBalance   Amount
+	TransCompletedTime    time.Time
+}
+
+// ParseReversalResult decodes the result of a transaction reversal.
+func ParseReversalResult(data []byte) (*ReversalResult, error) {
+	result, err := ParseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.AsReversal()
+}
+
+// AsReversal reads the typed fields of a transaction reversal result from the result parameters.
+func (r *Result) AsReversal() (*ReversalResult, error) {
+	p := &resultParser{result: r}
+	out := &ReversalResult{
+		Result:                *r,
+		Amount:                p.amount("Amount"),
+		OriginalTransactionID: p.string("OriginalTransactionID"),
+		Charge:                p.amount("Charge"),
+		CreditPartyPublicName: p.string("CreditPartyPublicName"),
+		DebitPartyPublicName:  p.string("DebitPartyPublicName"),
+		DebitAccountBalance:   p.balance("DebitAccountBalance"),
+		TransCompletedTime:    p.time("TransCompletedTime", utils.TimestampLayout),
+	}
+	out.ParseError = p.err
+	return out, p.err
+}
+
+// TransactionStatusResult is the typed result of a transaction status query.
+type TransactionStatusResult struct {
+	Result
+	ReceiptNo         string
+	TransactionStatus string
+	Amount            Amount
+	DebitPartyName    string
+	CreditPartyName   string
+	DebitAccountType  string
+	DebitPartyCharges Amount
+	TransactionReason string
+	ReasonType        string
+	InitiatedTime     time.Time
+	FinalisedTime     time.Time
+}
+
+// ParseTransactionStatusResult decodes the result of a transaction status query.
+func ParseTransactionStatusResult(data []byte) (*TransactionStatusResult, error) {
+	result, err := ParseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.AsTransactionStatus()
+}
+
+// AsTransactionStatus reads the typed fields of a transaction status query result from the result parameters.
+func (r *Result) AsTransactionStatus() (*TransactionStatusResult, error) {
+	p := &resultParser{result: r}
+	out := &TransactionStatusResult{
+		Result:            *r,
+		ReceiptNo:         p.string("ReceiptNo"),
+		TransactionStatus: p.string("TransactionStatus"),
+		Amount:            p.amount("Amount"),
+		DebitPartyName:    p.string("DebitPartyName"),
+		CreditPartyName:   p.string("CreditPartyName"),
+		DebitAccountType:  p.string("DebitAccountType"),
+		DebitPartyCharges: p.balance("DebitPartyCharges"),
+		TransactionReason: p.string("TransactionReason"),
+		ReasonType:        p.string("ReasonType"),
+		InitiatedTime:     p.time("InitiatedTime", utils.TimestampLayout),
+		FinalisedTime:     p.time("FinalisedTime", utils.TimestampLayout),
+	}
+	out.ParseError = p.err
+	return out, p.err
+}
+
+// BalanceResult is the typed result of an account balance query.
+type BalanceResult struct {
+	Result
+	AccountBalance  string
+	Accounts        []Account
+	BOCompletedTime time.Time
+}
+
+// Account returns the account with the given name, e.g. "Working Account".
+func (r *BalanceResult) Account(name string) (Account, bool) {
+	for _, account := range r.Accounts {
+		if account.Name == name {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+// ParseBalanceResult decodes the result of an account balance query.
+func ParseBalanceResult(data []byte) (*BalanceResult, error) {
+	result, err := ParseResult(data)
+	if err != nil {
+		return nil, err
+	}
+	return result.AsBalance()
+}
+
+// AsBalance reads the typed fields of an account balance query result from the result parameters.
+func (r *Result) AsBalance() (*BalanceResult, error) {
+	p := &resultParser{result: r}
+	out := &BalanceResult{
+		Result:          *r,
+		AccountBalance:  p.string("AccountBalance"),
+		BOCompletedTime: p.time("BOCompletedTime", utils.TimestampLayout),
+	}
+	accounts, err := ParseAccountBalance(out.AccountBalance)
+	if err != nil && p.err == nil {
+		p.err = err
+	}
+	out.Accounts = accounts
+	out.ParseError = p.err
+	return out, p.err
+}
+
+// Account is one account of an account balance result.
+type Account struct {
+	Name      string
+	Currency  string
+	Current   Amount
+	Available Amount
+	Reserved  Amount
+	Uncleared Amount
+}
+
+// ParseAccountBalance parses the AccountBalance result parameter, a list of
+// accounts separated by '&', each formatted as
+// Name|Currency|Current|Available|Reserved|Uncleared.
+func ParseAccountBalance(s string) ([]Account, error) {
+	var accounts []Account
+	for _, entry := range strings.Split(strings.TrimSpace(s), "&") {
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, "|")
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("invalid account balance entry %q: expected 6 fields, got %d", entry, len(fields))
+		}
+		account := Account{Name: fields[0], Currency: fields[1]}
+		for i, dst := range []*Amount{&account.Current, &account.Available, &account.Reserved, &account.Uncleared} {
+			amount, err := ParseAmount(fields[i+2])
+			if err != nil {
+				return nil, fmt.Errorf("invalid account balance entry %q: %w", entry, err)
+			}
+			*dst = amount
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
@@ -0,0 +1,92 @@
+package types
+
+import "fmt"
+
+// STKStatus is the final state of an STK Push.
+type STKStatus int
+
+const (
+	// STKPending means no final result is known yet.
+	STKPending STKStatus = iota
+	// STKSucceeded means the customer paid.
+	STKSucceeded
+	// STKCancelled means the customer cancelled the prompt (1032).
+	STKCancelled
+	// STKTimedOut means the customer could not be reached or did not respond (1037, 1019).
+	STKTimedOut
+	// STKWrongPIN means the customer entered a wrong PIN (2001).
+	STKWrongPIN
+	// STKInsufficientFunds means the customer's balance was too low (1).
+	STKInsufficientFunds
+	// STKFailed is any other final failure.
+	STKFailed
+)
+
+// String returns the status name.
+func (s STKStatus) String() string {
+	switch s {
+	case STKPending:
+		return "pending"
+	case STKSucceeded:
+		return "succeeded"
+	case STKCancelled:
+		return "cancelled"
+	case STKTimedOut:
+		return "timed out"
+	case STKWrongPIN:
+		return "wrong PIN"
+	case STKInsufficientFunds:
+		return "insufficient funds"
+	}
+	return "failed"
+}
+
+// MarshalText encodes the status as its name, so STKOutcome reads the same
+// in JSON as in logs.
+func (s STKStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a status name written by MarshalText.
+func (s *STKStatus) UnmarshalText(text []byte) error {
+	for status := STKPending; status <= STKFailed; status++ {
+		if status.String() == string(text) {
+			*s = status
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid STK status %q", text)
+}
+
+// STKStatusFromResultCode classifies an STK result code. An empty code or
+// ResultCodeStillProcessing is pending.
+func STKStatusFromResultCode(code string) STKStatus {
+	switch code {
+	case "", ResultCodeStillProcessing:
+		return STKPending
+	case ResultCodeSuccess:
+		return STKSucceeded
+	case ResultCodeCancelledByUser:
+		return STKCancelled
+	case ResultCodeUserUnreachable, ResultCodeTransactionExpired:
+		return STKTimedOut
+	case ResultCodeInvalidInitiator:
+		return STKWrongPIN
+	case ResultCodeInsufficientFunds:
+		return STKInsufficientFunds
+	}
+	return STKFailed
+}
+
+// STKOutcome is the final outcome of an STK Push, determined either from its
+// callback or by querying its status.
+type STKOutcome struct {
+	Status            STKStatus
+	MerchantRequestID string
+	CheckoutRequestID string
+	ResultCode        string
+	ResultDesc        string
+	// Callback is the decoded callback when the outcome came from it. Payment
+	// details such as the receipt number are only available there.
+	Callback *STKCallback
+}
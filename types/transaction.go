@@ -0,0 +1,111 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/freelancer254/mpesa-go/utils"
+)
+
+// TransactionType is the kind of a transaction returned by the Pull API.
+type TransactionType string
+
+// Transaction types returned by the Pull API.
+const (
+	TransactionPayBill  TransactionType = "c2b-pay-bill-debit"
+	TransactionBuyGoods TransactionType = "c2b-buy-goods-debit"
+)
+
+// trxDateLayouts are the formats of Transaction.TrxDate. Daraja sends Nairobi
+// wall-clock time, despite the trailing Z.
+var trxDateLayouts = []string{"2006-01-02T15:04:05Z", "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// Transaction represents a single transaction in the pull transactions response.
+type Transaction struct {
+	TransactionID string
+	// TrxDate is the transaction time in Nairobi time.
+	TrxDate time.Time
+	// Msisdn is the customer's number, which Daraja may mask, e.g. "2547***123".
+	Msisdn           string
+	Sender           string
+	TransactionType  TransactionType
+	BillReference    string
+	Amount           Amount
+	OrganizationName string
+	// Raw is the transaction as sent by Daraja, for values the typed fields
+	// do not capture.
+	Raw json.RawMessage `json:"-"`
+}
+
+// transactionJSON is the wire form of a Transaction. Daraja sends numbers
+// and strings interchangeably.
+type transactionJSON struct {
+	TransactionID    flexString `json:"transactionId"`
+	TrxDate          flexString `json:"trxDate"`
+	Msisdn           flexString `json:"msisdn"`
+	Sender           flexString `json:"sender"`
+	TransactionType  flexString `json:"transactiontype"`
+	BillReference    flexString `json:"billreference"`
+	Amount           flexString `json:"amount"`
+	OrganizationName flexString `json:"organizationname"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Transaction) UnmarshalJSON(data []byte) error {
+	var wire transactionJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	tx := Transaction{
+		TransactionID:    string(wire.TransactionID),
+		Msisdn:           string(wire.Msisdn),
+		Sender:           string(wire.Sender),
+		TransactionType:  TransactionType(wire.TransactionType),
+		BillReference:    string(wire.BillReference),
+		OrganizationName: string(wire.OrganizationName),
+		Raw:              append(json.RawMessage(nil), data...),
+	}
+	if date := strings.TrimSpace(string(wire.TrxDate)); date != "" {
+		var err error
+		for _, layout := range trxDateLayouts {
+			if tx.TrxDate, err = time.ParseInLocation(layout, date, utils.Nairobi); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("invalid transaction %s trxDate %q", tx.TransactionID, date)
+		}
+	}
+	if amount := strings.ReplaceAll(string(wire.Amount), ",", ""); amount != "" {
+		var err error
+		if tx.Amount, err = ParseAmount(amount); err != nil {
+			return fmt.Errorf("invalid transaction %s: %w", tx.TransactionID, err)
+		}
+	}
+	*t = tx
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, producing the form Daraja sends.
+func (t Transaction) MarshalJSON() ([]byte, error) {
+	wire := transactionJSON{
+		TransactionID:    flexString(t.TransactionID),
+		Msisdn:           flexString(t.Msisdn),
+		Sender:           flexString(t.Sender),
+		TransactionType:  flexString(t.TransactionType),
+		BillReference:    flexString(t.BillReference),
+		Amount:           flexString(t.Amount.String()),
+		OrganizationName: flexString(t.OrganizationName),
+	}
+	if !t.TrxDate.IsZero() {
+		wire.TrxDate = flexString(t.TrxDate.In(utils.Nairobi).Format(trxDateLayouts[0]))
+	}
+	return json.Marshal(wire)
+}
+
+// Masked reports whether Daraja masked digits of the customer's number.
+func (t *Transaction) Masked() bool {
+	return strings.Contains(t.Msisdn, "*")
+}
@@ -1,33 +1,58 @@
 // Package types defines the request and response structs for the M-Pesa Daraja API.
 package types
 
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 // AccessTokenResponse represents the response for an access token request.
 type AccessTokenResponse struct {
 	AccessToken string `json:"access_token"`
 	ExpiresIn   string `json:"expires_in"`
 }
 
+// Lifetime parses ExpiresIn, which Daraja sends as a string of seconds.
+func (r AccessTokenResponse) Lifetime() (time.Duration, error) {
+	seconds, err := strconv.Atoi(strings.TrimSpace(r.ExpiresIn))
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid expires_in %q", r.ExpiresIn)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
 // STKPushRequest represents the payload for an STK Push request.
+//
+// Password and Timestamp must be supplied together (see utils.STKPassword), or
+// both left empty to have the client derive them from a passkey configured
+// with Mpesa.SetPasskey.
 type STKPushRequest struct {
-	AccessToken       string `json:"AccessToken" validate:"required"`
-	BusinessShortCode string `json:"BusinessShortCode" validate:"required,numeric"`
-	Password          string `json:"Password" validate:"required"`
-	Amount            string `json:"Amount" validate:"required,numeric"`
-	PartyA            string `json:"PartyA" validate:"required,numeric"`
+	AccessToken       string `json:"AccessToken"`
+	BusinessShortCode string `json:"BusinessShortCode" validate:"omitempty,numeric"`
+	Password          string `json:"Password" validate:"required_with=Timestamp"`
+	Timestamp         string `json:"Timestamp" validate:"required_with=Password,omitempty,numeric,len=14"`
+	Amount            Amount `json:"Amount" validate:"required,amount=1-250000"`
+	PartyA            string `json:"PartyA" validate:"required,msisdn"`
 	PartyB            string `json:"PartyB" validate:"required,numeric"`
-	PhoneNumber       string `json:"PhoneNumber" validate:"required,numeric"`
+	PhoneNumber       string `json:"PhoneNumber" validate:"required,msisdn"`
 	CallBackURL       string `json:"CallBackURL" validate:"required,url"`
 	AccountReference  string `json:"AccountReference" validate:"required"`
 	TransactionDesc   string `json:"TransactionDesc" validate:"required"`
 }
 
 // STKPushQueryRequest represents the payload for an STK Push Query request.
+// Password and Timestamp follow the same rules as in STKPushRequest.
 type STKPushQueryRequest struct {
-	AccessToken       string `json:"AccessToken" validate:"required"`
-	BusinessShortCode string `json:"BusinessShortCode" validate:"required,numeric"`
-	Password          string `json:"Password" validate:"required"`
-	Timestamp         string `json:"Timestamp" validate:"required,numeric"`
-	CheckoutRequestID string `json:"CheckoutRequestID"`
+	AccessToken       string `json:"AccessToken"`
+	BusinessShortCode string `json:"BusinessShortCode" validate:"omitempty,numeric"`
+	Password          string `json:"Password" validate:"required_with=Timestamp"`
+	Timestamp         string `json:"Timestamp" validate:"required_with=Password,omitempty,numeric,len=14"`
+	CheckoutRequestID string `json:"CheckoutRequestID" validate:"required"`
 }
 
 // STKPushResponse represents the response for an STK Push request.
@@ -50,6 +75,9 @@ type STKPushQueryResponse struct {
 }
 
 // STKPushError represents the error response for an STK Push request.
+//
+// Deprecated: Daraja never returns this shape as an error; it is the body of
+// the STK Push callback. Use STKCallbackBody and ParseSTKCallback instead.
 type STKPushError struct {
 	Body struct {
 		StkCallback struct {
@@ -63,7 +91,7 @@ type STKPushError struct {
 
 // RegisterURLRequest represents the payload for registering URLs.
 type RegisterURLRequest struct {
-	AccessToken     string `json:"AccessToken" validate:"required"`
+	AccessToken     string `json:"AccessToken"`
 	ShortCode       string `json:"ShortCode" validate:"required,numeric"`
 	ResponseType    string `json:"ResponseType" validate:"required,eq=Completed|eq=Cancelled"`
 	ConfirmationURL string `json:"ConfirmationURL" validate:"required,url"`
@@ -79,10 +107,10 @@ type RegisterURLResponse struct {
 
 // SimulateTransactionRequest represents the payload for simulating a transaction.
 type SimulateTransactionRequest struct {
-	AccessToken   string `json:"AccessToken" validate:"required"`
+	AccessToken   string `json:"AccessToken"`
 	ShortCode     string `json:"ShortCode" validate:"required,numeric"`
-	Amount        string `json:"Amount" validate:"required,numeric"`
-	Msisdn        string `json:"Msisdn" validate:"required,numeric"`
+	Amount        Amount `json:"Amount" validate:"required,amount=1-250000"`
+	Msisdn        string `json:"Msisdn" validate:"required,msisdn"`
 	BillRefNumber string `json:"BillRefNumber" validate:"required"`
 }
 
@@ -95,11 +123,11 @@ type SimulateTransactionResponse struct {
 
 // ReverseTransactionRequest represents the payload for reversing a transaction.
 type ReverseTransactionRequest struct {
-	AccessToken            string `json:"AccessToken" validate:"required"`
+	AccessToken            string `json:"AccessToken"`
 	Initiator              string `json:"Initiator" validate:"required"`
 	SecurityCredential     string `json:"SecurityCredential" validate:"required"`
 	TransactionID          string `json:"TransactionID" validate:"required"`
-	Amount                 string `json:"Amount" validate:"required,numeric"`
+	Amount                 Amount `json:"Amount" validate:"required,amount=1"`
 	ReceiverParty          string `json:"ReceiverParty" validate:"required,numeric"`
 	ReceiverIdentifierType string `json:"ReceiverIdentifierType" validate:"required,numeric"`
 	ResultURL              string `json:"ResultURL" validate:"required,url"`
@@ -118,7 +146,7 @@ type ReverseTransactionResponse struct {
 
 // QueryTransactionRequest represents the payload for querying a transaction.
 type QueryTransactionRequest struct {
-	AccessToken              string `json:"AccessToken" validate:"required"`
+	AccessToken              string `json:"AccessToken"`
 	Initiator                string `json:"Initiator" validate:"required"`
 	SecurityCredential       string `json:"SecurityCredential" validate:"required"`
 	TransactionID            string `json:"TransactionID,omitempty"`
@@ -141,7 +169,7 @@ type QueryTransactionResponse struct {
 
 // GetBalanceRequest represents the payload for querying the account balance.
 type GetBalanceRequest struct {
-	AccessToken        string `json:"AccessToken" validate:"required"`
+	AccessToken        string `json:"AccessToken"`
 	Initiator          string `json:"Initiator" validate:"required"`
 	SecurityCredential string `json:"SecurityCredential" validate:"required"`
 	PartyA             string `json:"PartyA" validate:"required,numeric"`
@@ -159,21 +187,41 @@ type GetBalanceResponse struct {
 	ResponseCode             string `json:"ResponseCode"`
 }
 
-// B2CSendRequest represents the payload for a B2C send request.
+// B2CSendRequest represents the payload for a B2C send request. New code
+// should use B2CPaymentRequest, see V3.
 type B2CSendRequest struct {
-	AccessToken        string `json:"AccessToken" validate:"required"`
+	AccessToken        string `json:"AccessToken"`
 	InitiatorName      string `json:"InitiatorName" validate:"required"`
 	SecurityCredential string `json:"SecurityCredential" validate:"required"`
 	CommandID          string `json:"CommandID" validate:"required"`
-	Amount             string `json:"Amount" validate:"required,numeric"`
+	Amount             Amount `json:"Amount" validate:"required,amount=10-250000"`
 	PartyA             string `json:"PartyA" validate:"required,numeric"`
-	PartyB             string `json:"PartyB" validate:"required,numeric"`
+	PartyB             string `json:"PartyB" validate:"required,msisdn"`
 	Remarks            string `json:"Remarks" validate:"required"`
 	QueueTimeOutURL    string `json:"QueueTimeOutURL" validate:"required,url"`
 	ResultURL          string `json:"ResultURL" validate:"required,url"`
 	Occasion           string `json:"Occasion" validate:"required"`
 }
 
+// V3 returns the request as a B2C v3 payment request identified by
+// originatorConversationID.
+func (r B2CSendRequest) V3(originatorConversationID string) B2CPaymentRequest {
+	return B2CPaymentRequest{
+		AccessToken:              r.AccessToken,
+		OriginatorConversationID: originatorConversationID,
+		InitiatorName:            r.InitiatorName,
+		SecurityCredential:       r.SecurityCredential,
+		CommandID:                B2CCommandID(r.CommandID),
+		Amount:                   r.Amount,
+		PartyA:                   r.PartyA,
+		PartyB:                   r.PartyB,
+		Remarks:                  r.Remarks,
+		QueueTimeOutURL:          r.QueueTimeOutURL,
+		ResultURL:                r.ResultURL,
+		Occasion:                 r.Occasion,
+	}
+}
+
 // B2CSendResponse represents the response for a B2C send request.
 type B2CSendResponse struct {
 	ConversationID           string `json:"ConversationID"`
@@ -182,24 +230,132 @@ type B2CSendResponse struct {
 	ResponseCode             string `json:"ResponseCode"`
 }
 
+// B2CCommandID is the kind of a B2C payment.
+type B2CCommandID string
+
+// B2C payment kinds.
+const (
+	SalaryPayment    B2CCommandID = "SalaryPayment"
+	BusinessPayment  B2CCommandID = "BusinessPayment"
+	PromotionPayment B2CCommandID = "PromotionPayment"
+)
+
+// B2CPaymentRequest represents the payload for a B2C v3 payment request.
+// OriginatorConversationID is chosen by the caller and echoed in the
+// acknowledgement and the result.
+type B2CPaymentRequest struct {
+	AccessToken              string       `json:"AccessToken"`
+	OriginatorConversationID string       `json:"OriginatorConversationID" validate:"required,max=100"`
+	InitiatorName            string       `json:"InitiatorName" validate:"required"`
+	SecurityCredential       string       `json:"SecurityCredential" validate:"required"`
+	CommandID                B2CCommandID `json:"CommandID" validate:"required,oneof=SalaryPayment BusinessPayment PromotionPayment"`
+	Amount                   Amount       `json:"Amount" validate:"required,amount=10-250000"`
+	PartyA                   string       `json:"PartyA" validate:"required,numeric"`
+	PartyB                   string       `json:"PartyB" validate:"required,msisdn"`
+	Remarks                  string       `json:"Remarks" validate:"required,max=100"`
+	QueueTimeOutURL          string       `json:"QueueTimeOutURL" validate:"required,url"`
+	ResultURL                string       `json:"ResultURL" validate:"required,url"`
+	Occasion                 string       `json:"Occasion" validate:"max=100"`
+}
+
 // B2BSendRequest represents the payload for a B2B send request.
 type B2BSendRequest struct {
-	AccessToken            string `json:"AccessToken" validate:"required"`
+	AccessToken            string `json:"AccessToken"`
 	Initiator              string `json:"Initiator" validate:"required"`
 	SecurityCredential     string `json:"SecurityCredential" validate:"required"`
 	CommandID              string `json:"CommandID" validate:"required"`
 	SenderIdentifierType   string `json:"SenderIdentifierType" validate:"required,numeric"`
 	ReceiverIdentifierType string `json:"RecieverIdentifierType" validate:"required,numeric"`
-	Amount                 string `json:"Amount" validate:"required,numeric"`
+	Amount                 Amount `json:"Amount" validate:"required,amount=1"`
 	PartyA                 string `json:"PartyA" validate:"required,numeric"`
 	PartyB                 string `json:"PartyB" validate:"required,numeric"`
 	Remarks                string `json:"Remarks" validate:"required"`
 	AccountReference       string `json:"AccountReference" validate:"required"`
-	Requester              string `json:"Requester" validate:"required,numeric"`
+	Requester              string `json:"Requester" validate:"required,msisdn"`
 	QueueTimeOutURL        string `json:"QueueTimeOutURL" validate:"required,url"`
 	ResultURL              string `json:"ResultURL" validate:"required,url"`
 }
 
+// Identifier types of the parties to a B2B payment.
+const (
+	IdentifierTillNumber = "2"
+	IdentifierShortCode  = "4"
+)
+
+// BusinessPayBillRequest represents the payload for paying a paybill from a
+// shortcode. AccountReference is the account number at the paybill.
+// Requester, the customer the payment is made for, is optional.
+type BusinessPayBillRequest struct {
+	AccessToken        string `json:"AccessToken"`
+	Initiator          string `json:"Initiator" validate:"required"`
+	SecurityCredential string `json:"SecurityCredential" validate:"required"`
+	Amount             Amount `json:"Amount" validate:"required,amount=1"`
+	PartyA             string `json:"PartyA" validate:"required,numeric"`
+	PartyB             string `json:"PartyB" validate:"required,numeric"`
+	AccountReference   string `json:"AccountReference" validate:"required"`
+	Remarks            string `json:"Remarks" validate:"required"`
+	Requester          string `json:"Requester" validate:"omitempty,msisdn"`
+	QueueTimeOutURL    string `json:"QueueTimeOutURL" validate:"required,url"`
+	ResultURL          string `json:"ResultURL" validate:"required,url"`
+}
+
+// B2B returns the request as a BusinessPayBill B2B send request.
+func (r BusinessPayBillRequest) B2B() B2BSendRequest {
+	return B2BSendRequest{
+		AccessToken:            r.AccessToken,
+		Initiator:              r.Initiator,
+		SecurityCredential:     r.SecurityCredential,
+		CommandID:              "BusinessPayBill",
+		SenderIdentifierType:   IdentifierShortCode,
+		ReceiverIdentifierType: IdentifierShortCode,
+		Amount:                 r.Amount,
+		PartyA:                 r.PartyA,
+		PartyB:                 r.PartyB,
+		Remarks:                r.Remarks,
+		AccountReference:       r.AccountReference,
+		Requester:              r.Requester,
+		QueueTimeOutURL:        r.QueueTimeOutURL,
+		ResultURL:              r.ResultURL,
+	}
+}
+
+// BusinessBuyGoodsRequest represents the payload for paying a till from a
+// shortcode. PartyB is the till number; AccountReference and Requester are
+// optional.
+type BusinessBuyGoodsRequest struct {
+	AccessToken        string `json:"AccessToken"`
+	Initiator          string `json:"Initiator" validate:"required"`
+	SecurityCredential string `json:"SecurityCredential" validate:"required"`
+	Amount             Amount `json:"Amount" validate:"required,amount=1"`
+	PartyA             string `json:"PartyA" validate:"required,numeric"`
+	PartyB             string `json:"PartyB" validate:"required,numeric"`
+	AccountReference   string `json:"AccountReference"`
+	Remarks            string `json:"Remarks" validate:"required"`
+	Requester          string `json:"Requester" validate:"omitempty,msisdn"`
+	QueueTimeOutURL    string `json:"QueueTimeOutURL" validate:"required,url"`
+	ResultURL          string `json:"ResultURL" validate:"required,url"`
+}
+
+// B2B returns the request as a BusinessBuyGoods B2B send request.
+func (r BusinessBuyGoodsRequest) B2B() B2BSendRequest {
+	return B2BSendRequest{
+		AccessToken:            r.AccessToken,
+		Initiator:              r.Initiator,
+		SecurityCredential:     r.SecurityCredential,
+		CommandID:              "BusinessBuyGoods",
+		SenderIdentifierType:   IdentifierShortCode,
+		ReceiverIdentifierType: IdentifierTillNumber,
+		Amount:                 r.Amount,
+		PartyA:                 r.PartyA,
+		PartyB:                 r.PartyB,
+		Remarks:                r.Remarks,
+		AccountReference:       r.AccountReference,
+		Requester:              r.Requester,
+		QueueTimeOutURL:        r.QueueTimeOutURL,
+		ResultURL:              r.ResultURL,
+	}
+}
+
 // B2BSendResponse represents the response for a B2B send request.
 type B2BSendResponse struct {
 	ConversationID           string `json:"ConversationID"`
@@ -208,11 +364,100 @@ type B2BSendResponse struct {
 	ResponseDescription      string `json:"ResponseDescription"`
 }
 
+// KRAShortCode is the Kenya Revenue Authority paybill taxes are remitted to.
+const KRAShortCode = "572572"
+
+// RemitTaxRequest represents the payload for remitting tax to KRA. PRN is the
+// payment registration number generated on iTax for the tax being paid; it
+// is sent as the AccountReference.
+type RemitTaxRequest struct {
+	AccessToken        string `json:"AccessToken"`
+	Initiator          string `json:"Initiator" validate:"required"`
+	SecurityCredential string `json:"SecurityCredential" validate:"required"`
+	Amount             Amount `json:"Amount" validate:"required,amount=1"`
+	PartyA             string `json:"PartyA" validate:"required,numeric"`
+	PRN                string `json:"AccountReference" validate:"required,prn"`
+	Remarks            string `json:"Remarks" validate:"required"`
+	QueueTimeOutURL    string `json:"QueueTimeOutURL" validate:"required,url"`
+	ResultURL          string `json:"ResultURL" validate:"required,url"`
+}
+
+// B2BExpressCheckoutRequest represents the payload for a B2B Express
+// Checkout, which pushes a USSD prompt to the operator of PrimaryShortCode to
+// pay ReceiverShortCode. The outcome is posted to CallbackURL, see
+// B2BExpressCheckoutCallback.
+type B2BExpressCheckoutRequest struct {
+	AccessToken       string `json:"AccessToken"`
+	PrimaryShortCode  string `json:"primaryShortCode" validate:"required,numeric"`
+	ReceiverShortCode string `json:"receiverShortCode" validate:"required,numeric"`
+	Amount            Amount `json:"amount" validate:"required,amount=1"`
+	PaymentRef        string `json:"paymentRef" validate:"required"`
+	CallbackURL       string `json:"callbackUrl" validate:"required,url"`
+	PartnerName       string `json:"partnerName" validate:"required"`
+	RequestRefID      string `json:"RequestRefID" validate:"required"`
+}
+
+// B2BExpressCheckoutResponse represents the response for a B2B Express Checkout.
+type B2BExpressCheckoutResponse struct {
+	Code   string `json:"code"`
+	Status string `json:"status"`
+}
+
+// QRTrxCode is the kind of transaction a dynamic QR code pays for.
+type QRTrxCode string
+
+// Dynamic QR transaction kinds.
+const (
+	QRBuyGoods       QRTrxCode = "BG"
+	QRWithdrawAgent  QRTrxCode = "WA"
+	QRPayBill        QRTrxCode = "PB"
+	QRSendMoney      QRTrxCode = "SM"
+	QRSendToBusiness QRTrxCode = "SB"
+)
+
+// QRCodeRequest represents the payload for generating a dynamic M-Pesa QR
+// code. CPI, the credit party identifier, is the till, agent number,
+// paybill, phone number or business number matching TrxCode. Size is the
+// image width in pixels, e.g. "300".
+type QRCodeRequest struct {
+	AccessToken  string    `json:"AccessToken"`
+	MerchantName string    `json:"MerchantName" validate:"required"`
+	RefNo        string    `json:"RefNo" validate:"required"`
+	Amount       Amount    `json:"Amount" validate:"required,amount=1"`
+	TrxCode      QRTrxCode `json:"TrxCode" validate:"required,oneof=BG WA PB SM SB"`
+	CPI          string    `json:"CPI" validate:"required"`
+	Size         string    `json:"Size" validate:"required,numeric"`
+}
+
+// QRCodeResponse represents the response for generating a dynamic QR code.
+// QRCode is the base64 encoded PNG image, see PNG.
+type QRCodeResponse struct {
+	ResponseCode        string `json:"ResponseCode"`
+	RequestID           string `json:"RequestID"`
+	ResponseDescription string `json:"ResponseDescription"`
+	QRCode              string `json:"QRCode"`
+}
+
+// pngSignature starts every PNG file.
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// PNG decodes the QR code image.
+func (r *QRCodeResponse) PNG() ([]byte, error) {
+	image, err := base64.StdEncoding.DecodeString(strings.TrimSpace(r.QRCode))
+	if err != nil {
+		return nil, fmt.Errorf("invalid QR code: %w", err)
+	}
+	if !bytes.HasPrefix(image, []byte(pngSignature)) {
+		return nil, errors.New("invalid QR code: not a PNG image")
+	}
+	return image, nil
+}
+
 // RegisterPullAPIRequest represents the payload for registering the pull API.
 type RegisterPullAPIRequest struct {
-	AccessToken     string `json:"AccessToken" validate:"required"`
+	AccessToken     string `json:"AccessToken"`
 	ShortCode       string `json:"ShortCode" validate:"required,numeric"`
-	NominatedNumber string `json:"NominatedNumber" validate:"required,numeric"`
+	NominatedNumber string `json:"NominatedNumber" validate:"required,msisdn"`
 	CallBackURL     string `json:"CallBackURL" validate:"required,url"`
 }
 
@@ -226,10 +471,10 @@ type RegisterPullAPIResponse struct {
 
 // PullTransactionsRequest represents the payload for pulling transactions.
 type PullTransactionsRequest struct {
-	AccessToken string `json:"AccessToken" validate:"required"`
+	AccessToken string `json:"AccessToken"`
 	ShortCode   string `json:"ShortCode" validate:"required,numeric"`
-	StartDate   string `json:"StartDate" validate:"required,datetime=2006-01-02"`
-	EndDate     string `json:"EndDate" validate:"required,datetime=2006-01-02"`
+	StartDate   string `json:"StartDate" validate:"required,datetime=2006-01-02|datetime=2006-01-02 15:04:05"`
+	EndDate     string `json:"EndDate" validate:"required,datetime=2006-01-02|datetime=2006-01-02 15:04:05"`
 	OffSetValue string `json:"OffSetValue" validate:"required,numeric"`
 }
 
@@ -240,15 +485,3 @@ type PullTransactionsResponse struct {
 	ResponseMessage string        `json:"ResponseMessage"`
 	Transactions    []Transaction `json:"Response"`
 }
-
-// Transaction represents a single transaction in the pull transactions response.
-type Transaction struct {
-	TransactionID    string `json:"transactionId"`
-	TrxDate          string `json:"trxDate"`
-	Msisdn           int64  `json:"msisdn"`
-	Sender           string `json:"sender"`
-	TransactionType  string `json:"transactiontype"`
-	BillReference    string `json:"billreference"`
-	Amount           string `json:"amount"`
-	OrganizationName string `json:"organizationname"`
-}
@@ -7,6 +7,13 @@ import (
 	"time"
 )
 
+// TimestampLayout is the YYYYMMDDHHMMSS layout Daraja uses for timestamps.
+const TimestampLayout = "20060102150405"
+
+// Nairobi is the East Africa Time zone Daraja timestamps are expressed in.
+// Kenya observes no daylight saving, so a fixed offset is exact.
+var Nairobi = time.FixedZone("EAT", 3*60*60)
+
 // CheckKeys validates that the required keys are present in the payload.
 func CheckKeys(requiredKeys []string, payload map[string]interface{}) (map[string]interface{}, error) {
 	cleanedPayload := make(map[string]interface{})
@@ -20,14 +27,39 @@ func CheckKeys(requiredKeys []string, payload map[string]interface{}) (map[strin
 	return cleanedPayload, nil
 }
 
-// GetTimestamp returns the current timestamp in YYYYMMDDHHMMSS format.
+// GetTimestamp returns the current Nairobi time in YYYYMMDDHHMMSS format.
 func GetTimestamp() string {
-	return time.Now().Format("20060102150405")
+	return FormatTimestamp(time.Now())
+}
+
+// FormatTimestamp formats t in Nairobi time as YYYYMMDDHHMMSS.
+func FormatTimestamp(t time.Time) string {
+	return t.In(Nairobi).Format(TimestampLayout)
+}
+
+// ParseTimestamp parses a YYYYMMDDHHMMSS timestamp as Nairobi time.
+func ParseTimestamp(timestamp string) (time.Time, error) {
+	return time.ParseInLocation(TimestampLayout, timestamp, Nairobi)
 }
 
-// EncodePassword encodes the password using shortcode, passkey, and timestamp.
+// EncodePassword encodes the password using shortcode, passkey, and the current timestamp.
+//
+// The timestamp it uses is not returned, so the request may carry a different one;
+// prefer STKPassword, which returns the pair together.
 func EncodePassword(shortcode, passkey string) string {
-	timestamp := GetTimestamp()
+	password, _ := STKPassword(shortcode, passkey, time.Now())
+	return password
+}
+
+// EncodePasswordWithTimestamp encodes the password using shortcode, passkey, and the given timestamp.
+func EncodePasswordWithTimestamp(shortcode, passkey, timestamp string) string {
 	data := shortcode + passkey + timestamp
 	return base64.StdEncoding.EncodeToString([]byte(data))
 }
+
+// STKPassword derives the STK Push password and the timestamp it was built
+// from for the instant t. Both values must be sent together.
+func STKPassword(shortcode, passkey string, t time.Time) (password, timestamp string) {
+	timestamp = FormatTimestamp(t)
+	return EncodePasswordWithTimestamp(shortcode, passkey, timestamp), timestamp
+}